@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"countryCurrency/internal/config"
 	"countryCurrency/internal/database"
 	"countryCurrency/internal/handlers"
+	"countryCurrency/internal/models"
 	"countryCurrency/internal/services"
 )
 
@@ -35,15 +38,70 @@ func main() {
 
 	repo := database.NewRepository(db)
 
-	apiClient := services.NewAPIClient(cfg.CountriesAPIURL, cfg.ExchangeAPIURL)
+	apiClient := services.NewAPIClient(repo, cfg.CountriesAPIURL, cfg.ExchangeAPIURL, cfg.UpstreamCacheDir, cfg.CountriesFetchTimeout, cfg.RatesFetchTimeout)
 
-	imageService := services.NewImageService(repo, "./cache/summary.png")
+	imageService, err := services.NewImageService(repo, services.ImageSettings{
+		Path:         "./cache/summary.png",
+		FontPath:     cfg.ImageFontPath,
+		CacheEntries: cfg.ImageCacheEntries,
+		CacheBytes:   int64(cfg.ImageCacheMaxMB) << 20,
+		JPEGQuality:  cfg.ImageJPEGQuality,
+		ThemesPath:   cfg.ImageThemesPath,
+		Theme:        cfg.ImageTheme,
 
-	countryService := services.NewCountryService(repo, apiClient, imageService)
+		HistoryDir:    "./cache/history",
+		HistoryKeep:   cfg.ImageHistoryKeep,
+		HistoryMaxAge: time.Duration(cfg.ImageHistoryDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize image service: %v", err)
+	}
+
+	currencies, err := services.NewCurrencyRegistry()
+	if err != nil {
+		log.Fatalf("Failed to load currency table: %v", err)
+	}
+
+	flagCache := services.NewFlagCache(repo, services.FlagSettings{
+		Dir:         cfg.FlagCacheDir,
+		Concurrency: cfg.FlagFetchConcurrency,
+		Timeout:     cfg.FlagFetchTimeout,
+		LocalURLs:   cfg.FlagURLMode == "local",
+		BaseURL:     cfg.PublicBaseURL,
+	})
+
+	countryService := services.NewCountryService(repo, apiClient, imageService, flagCache, currencies, services.RefreshSettings{
+		MaxFailedRows:  cfg.RefreshMaxFailedRows,
+		BatchSize:      cfg.RefreshBatchSize,
+		MissingPolicy:  services.MissingPolicy(cfg.RefreshMissingPolicy),
+		RateAnomalyPct: cfg.RateAnomalyThresholdPct,
+		MaxInvalidPct:  cfg.RefreshMaxInvalidPct,
+
+		SnapshotRetention: time.Duration(cfg.SnapshotRetentionDays) * 24 * time.Hour,
+	})
+
+	refreshJobs := services.NewRefreshJobs(countryService, repo, 100)
+
+	countryHandler := handlers.NewCountryHandler(repo, countryService, imageService, flagCache, refreshJobs)
+
+	refreshHandler := handlers.NewRefreshHandler(repo, refreshJobs)
+
+	ratesHandler := handlers.NewRatesHandler(repo, countryService, refreshJobs)
+
+	currencyHandler := handlers.NewCurrencyHandler(currencies)
 
-	countryHandler := handlers.NewCountryHandler(repo, countryService, imageService)
+	entries, err := scheduleEntries(cfg)
+	if err != nil {
+		log.Fatalf("Invalid refresh schedule: %v", err)
+	}
+	if len(entries) > 0 {
+		// The scheduler's MySQL lease is released with its connection when the process exits
+		scheduler := services.NewScheduler(refreshJobs, repo, entries, cfg.RefreshScheduleJitter)
+		go scheduler.Run(context.Background())
+		log.Printf("Refresh scheduler enabled with %d schedule(s)", len(entries))
+	}
 
-	router := setupRouter(countryHandler)
+	router := setupRouter(countryHandler, refreshHandler, ratesHandler, currencyHandler)
 
 	addr := fmt.Sprintf(":%s", cfg.ServerPort)
 	log.Printf("Server starting on %s", addr)
@@ -53,7 +111,38 @@ func main() {
 	}
 }
 
-func setupRouter(handler *handlers.CountryHandler) *gin.Engine {
+// scheduleEntries builds the cron schedules configured for the built-in scheduler
+func scheduleEntries(cfg *config.Config) ([]services.ScheduleEntry, error) {
+	var entries []services.ScheduleEntry
+
+	if cfg.RefreshSchedule != "" {
+		schedule, err := services.ParseSchedule(cfg.RefreshSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("REFRESH_SCHEDULE: %w", err)
+		}
+		entries = append(entries, services.ScheduleEntry{
+			Name:     "countries",
+			Schedule: schedule,
+			Options:  services.RefreshOptions{Trigger: models.TriggerSchedule},
+		})
+	}
+
+	if cfg.RatesRefreshSchedule != "" {
+		schedule, err := services.ParseSchedule(cfg.RatesRefreshSchedule)
+		if err != nil {
+			return nil, fmt.Errorf("RATES_REFRESH_SCHEDULE: %w", err)
+		}
+		entries = append(entries, services.ScheduleEntry{
+			Name:     "rates",
+			Schedule: schedule,
+			Options:  services.RefreshOptions{Trigger: models.TriggerSchedule, Scope: models.ScopeRates},
+		})
+	}
+
+	return entries, nil
+}
+
+func setupRouter(handler *handlers.CountryHandler, refreshHandler *handlers.RefreshHandler, ratesHandler *handlers.RatesHandler, currencyHandler *handlers.CurrencyHandler) *gin.Engine {
 	router := gin.Default()
 
 	router.GET("/health", func(c *gin.Context) {
@@ -65,10 +154,33 @@ func setupRouter(handler *handlers.CountryHandler) *gin.Engine {
 		countryRoutes.POST("/refresh", handler.RefreshCountries)
 		countryRoutes.GET("", handler.GetAllCountries)
 		countryRoutes.GET("/image", handler.GetSummaryImage)
+		countryRoutes.GET("/image/history", handler.GetImageHistory)
+		countryRoutes.GET("/image/animated", handler.GetAnimatedImage)
+		countryRoutes.GET("/image/:run_id", handler.GetRunImage)
 		countryRoutes.GET("/:name", handler.GetCountryByName)
 		countryRoutes.DELETE("/:name", handler.DeleteCountryByName)
+		countryRoutes.GET("/:name/flag", handler.GetCountryFlag)
+		countryRoutes.POST("/:name/refresh", handler.RefreshCountry)
+	}
+
+	refreshRoutes := router.Group("/refresh")
+	{
+		refreshRoutes.GET("/runs", refreshHandler.GetRefreshRuns)
+		refreshRoutes.GET("/runs/:id", refreshHandler.GetRefreshRun)
+		refreshRoutes.GET("/jobs/:id", refreshHandler.GetRefreshJob)
 	}
 
+	rateRoutes := router.Group("/rates")
+	{
+		rateRoutes.POST("/refresh", handler.RefreshRates)
+		rateRoutes.GET("/quarantine", ratesHandler.GetQuarantine)
+		rateRoutes.POST("/quarantine/:id/approve", ratesHandler.ApproveQuarantine)
+		rateRoutes.POST("/quarantine/:id/reject", ratesHandler.RejectQuarantine)
+	}
+
+	router.GET("/iso4217", currencyHandler.GetCurrencies)
+	router.GET("/iso4217/:code", currencyHandler.GetCurrency)
+
 	router.GET("/status", handler.GetStatus)
 
 	return router
@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -17,6 +20,31 @@ type Config struct {
 	ServerPort	string
 	CountriesAPIURL	string
 	ExchangeAPIURL	string
+	UpstreamCacheDir	string
+	CountriesFetchTimeout	time.Duration
+	RatesFetchTimeout	time.Duration
+	RefreshMaxFailedRows	int
+	RefreshBatchSize	int
+	RefreshMissingPolicy	string
+	RefreshSchedule	string
+	RatesRefreshSchedule	string
+	RefreshScheduleJitter	time.Duration
+	RateAnomalyThresholdPct	float64
+	RefreshMaxInvalidPct	float64
+	ImageFontPath	string
+	ImageCacheEntries	int
+	ImageCacheMaxMB	int
+	ImageJPEGQuality	int
+	ImageHistoryKeep	int
+	ImageHistoryDays	int
+	ImageTheme	string
+	ImageThemesPath	string
+	SnapshotRetentionDays	int
+	FlagCacheDir	string
+	FlagURLMode	string
+	FlagFetchConcurrency	int
+	FlagFetchTimeout	time.Duration
+	PublicBaseURL	string
 }
 
 func Load() (*Config, error) {
@@ -31,6 +59,63 @@ func Load() (*Config, error) {
 		ServerPort: getEnv("PORT", "8080"),
 		CountriesAPIURL: getEnv("COUNTRIES_API_URL", "https://restcountries.com/v2/all?fields=name,capital,region,population,flag,currencies"),
 		ExchangeAPIURL: getEnv("EXCHANGE_API_URL", "https://open.er-api.com/v6/latest/USD"),
+		UpstreamCacheDir: getEnv("UPSTREAM_CACHE_DIR", "./cache/upstream"),
+		RefreshMissingPolicy: getEnv("REFRESH_MISSING_POLICY", "keep"),
+		RefreshSchedule: getEnv("REFRESH_SCHEDULE"),
+		RatesRefreshSchedule: getEnv("RATES_REFRESH_SCHEDULE"),
+		ImageFontPath: getEnv("IMAGE_FONT_PATH"),
+		ImageTheme: getEnv("IMAGE_THEME", "light"),
+		ImageThemesPath: getEnv("IMAGE_THEMES_PATH"),
+		FlagCacheDir: getEnv("FLAG_CACHE_DIR", "./cache/flags"),
+		FlagURLMode: getEnv("FLAG_URL_MODE", "upstream"),
+		PublicBaseURL: strings.TrimSuffix(getEnv("PUBLIC_BASE_URL"), "/"),
+	}
+
+	var err error
+	if cfg.CountriesFetchTimeout, err = getEnvDuration("COUNTRIES_FETCH_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RatesFetchTimeout, err = getEnvDuration("RATES_FETCH_TIMEOUT", 15*time.Second); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshMaxFailedRows, err = getEnvInt("REFRESH_MAX_FAILED_ROWS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshBatchSize, err = getEnvInt("REFRESH_BATCH_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshScheduleJitter, err = getEnvDuration("REFRESH_SCHEDULE_JITTER", time.Minute); err != nil {
+		return nil, err
+	}
+	if cfg.RateAnomalyThresholdPct, err = getEnvFloat("RATE_ANOMALY_THRESHOLD_PCT", 0); err != nil {
+		return nil, err
+	}
+	if cfg.RefreshMaxInvalidPct, err = getEnvFloat("REFRESH_MAX_INVALID_PCT", 10); err != nil {
+		return nil, err
+	}
+	if cfg.ImageCacheEntries, err = getEnvInt("IMAGE_CACHE_ENTRIES", 64); err != nil {
+		return nil, err
+	}
+	if cfg.ImageCacheMaxMB, err = getEnvInt("IMAGE_CACHE_MAX_MB", 32); err != nil {
+		return nil, err
+	}
+	if cfg.ImageJPEGQuality, err = getEnvInt("IMAGE_JPEG_QUALITY", 85); err != nil {
+		return nil, err
+	}
+	if cfg.ImageHistoryKeep, err = getEnvInt("IMAGE_HISTORY_KEEP", 100); err != nil {
+		return nil, err
+	}
+	if cfg.ImageHistoryDays, err = getEnvInt("IMAGE_HISTORY_DAYS", 0); err != nil {
+		return nil, err
+	}
+	if cfg.SnapshotRetentionDays, err = getEnvInt("SNAPSHOT_RETENTION_DAYS", 365); err != nil {
+		return nil, err
+	}
+	if cfg.FlagFetchConcurrency, err = getEnvInt("FLAG_FETCH_CONCURRENCY", 8); err != nil {
+		return nil, err
+	}
+	if cfg.FlagFetchTimeout, err = getEnvDuration("FLAG_FETCH_TIMEOUT", 10*time.Second); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
@@ -47,6 +132,42 @@ func getEnv(key string, defaultValue ...string) string {
 	return ""
 }
 
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer: %w", key, err)
+	}
+	return n, nil
+}
+
+func getEnvFloat(key string, defaultValue float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return f, nil
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration such as 30s: %w", key, err)
+	}
+	return d, nil
+}
+
 
 func (c *Config) Validate() error {
 	if c.DBName == "" {
@@ -64,5 +185,58 @@ func (c *Config) Validate() error {
 	if c.ServerPort == "" {
 		return fmt.Errorf("PORT is required")
 	}
+	if c.CountriesFetchTimeout <= 0 {
+		return fmt.Errorf("COUNTRIES_FETCH_TIMEOUT must be positive")
+	}
+	if c.RatesFetchTimeout <= 0 {
+		return fmt.Errorf("RATES_FETCH_TIMEOUT must be positive")
+	}
+	if c.RefreshMaxFailedRows < 0 {
+		return fmt.Errorf("REFRESH_MAX_FAILED_ROWS must not be negative")
+	}
+	if c.RefreshBatchSize <= 0 {
+		return fmt.Errorf("REFRESH_BATCH_SIZE must be positive")
+	}
+	switch c.RefreshMissingPolicy {
+	case "keep", "stale", "delete":
+	default:
+		return fmt.Errorf("REFRESH_MISSING_POLICY must be one of keep, stale, delete")
+	}
+	if c.RefreshScheduleJitter < 0 {
+		return fmt.Errorf("REFRESH_SCHEDULE_JITTER must not be negative")
+	}
+	if c.RateAnomalyThresholdPct < 0 {
+		return fmt.Errorf("RATE_ANOMALY_THRESHOLD_PCT must not be negative")
+	}
+	if c.RefreshMaxInvalidPct < 0 || c.RefreshMaxInvalidPct > 100 {
+		return fmt.Errorf("REFRESH_MAX_INVALID_PCT must be between 0 and 100")
+	}
+	if c.ImageCacheEntries < 0 {
+		return fmt.Errorf("IMAGE_CACHE_ENTRIES must not be negative")
+	}
+	if c.ImageCacheMaxMB < 0 {
+		return fmt.Errorf("IMAGE_CACHE_MAX_MB must not be negative")
+	}
+	if c.ImageJPEGQuality < 1 || c.ImageJPEGQuality > 100 {
+		return fmt.Errorf("IMAGE_JPEG_QUALITY must be between 1 and 100")
+	}
+	if c.ImageHistoryKeep < 0 {
+		return fmt.Errorf("IMAGE_HISTORY_KEEP must not be negative")
+	}
+	if c.ImageHistoryDays < 0 {
+		return fmt.Errorf("IMAGE_HISTORY_DAYS must not be negative")
+	}
+	if c.SnapshotRetentionDays < 0 {
+		return fmt.Errorf("SNAPSHOT_RETENTION_DAYS must not be negative")
+	}
+	if c.FlagURLMode != "upstream" && c.FlagURLMode != "local" {
+		return fmt.Errorf("FLAG_URL_MODE must be one of upstream, local")
+	}
+	if c.FlagFetchConcurrency <= 0 {
+		return fmt.Errorf("FLAG_FETCH_CONCURRENCY must be positive")
+	}
+	if c.FlagFetchTimeout <= 0 {
+		return fmt.Errorf("FLAG_FETCH_TIMEOUT must be positive")
+	}
 	return nil
 }
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+// SaveCountrySnapshot copies the current countries into country_snapshots
+// under runID, so later charts can show how they changed
+func (r *Repository) SaveCountrySnapshot(runID int64, at time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT IGNORE INTO country_snapshots (run_id, name, region, population, exchange_rate, estimated_gdp, captured_at)
+		SELECT ?, name, region, population, exchange_rate, estimated_gdp, ?
+		FROM countries
+		WHERE deleted_at IS NULL AND stale_since IS NULL`,
+		runID, at,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save country snapshot: %w", err)
+	}
+	return nil
+}
+
+// GetSnapshotRuns lists the runs captured between from and to, oldest first.
+// A zero from or to leaves that end open.
+func (r *Repository) GetSnapshotRuns(from, to time.Time) ([]models.SnapshotRun, error) {
+	query := "SELECT run_id, MIN(captured_at) FROM country_snapshots WHERE 1 = 1"
+	args := []interface{}{}
+
+	if !from.IsZero() {
+		query += " AND captured_at >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND captured_at <= ?"
+		args = append(args, to)
+	}
+	query += " GROUP BY run_id ORDER BY run_id"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.SnapshotRun{}
+	for rows.Next() {
+		var run models.SnapshotRun
+		if err := rows.Scan(&run.RunID, &run.CapturedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetTopSnapshotCountries is GetTopCountriesByMetric for the countries as
+// captured by runID. Only the fields a chart needs are filled in.
+func (r *Repository) GetTopSnapshotCountries(runID int64, metric, region string, limit int) ([]models.Country, error) {
+	expr, ok := metricExpressions[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+
+	query := "SELECT name, region, population, exchange_rate, estimated_gdp FROM country_snapshots WHERE run_id = ? AND " + expr + " IS NOT NULL"
+	args := []interface{}{runID}
+
+	if region != "" {
+		query += " AND LOWER(region) = LOWER(?)"
+		args = append(args, region)
+	}
+
+	query += " ORDER BY " + expr + " DESC, name ASC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snapshot countries: %w", err)
+	}
+	defer rows.Close()
+
+	countries := []models.Country{}
+	for rows.Next() {
+		var c models.Country
+		if err := rows.Scan(&c.Name, &c.Region, &c.Population, &c.ExchangeRate, &c.EstimatedGDP); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot country: %w", err)
+		}
+		countries = append(countries, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return countries, nil
+}
+
+// PruneCountrySnapshots deletes snapshots captured before cutoff
+func (r *Repository) PruneCountrySnapshots(cutoff time.Time) (int64, error) {
+	result, err := r.db.Exec("DELETE FROM country_snapshots WHERE captured_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune country snapshots: %w", err)
+	}
+	return result.RowsAffected()
+}
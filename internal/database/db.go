@@ -42,6 +42,12 @@ func runMigrations(db *sql.DB) error {
 	for _, stmt := range []string{
 		CreateCountriesTable,
 		CreateMetadataTable,
+		CreateRefreshRunsTable,
+		CreateRateQuarantineTable,
+		CreateSummaryImagesTable,
+		CreateCountrySnapshotsTable,
+		CreateFlagAssetsTable,
+		CreateUpstreamValidatorsTable,
 		InitialMetadata,
 	} {
 		if _, err := tx.Exec(stmt); err != nil {
@@ -50,5 +56,34 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
+	// MySQL has no ADD COLUMN IF NOT EXISTS, so check information_schema first
+	for _, m := range columnMigrations {
+		if err := addColumnIfMissing(tx, m); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	return tx.Commit()
 }
+
+func addColumnIfMissing(tx *sql.Tx, m columnMigration) error {
+	var count int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		m.table, m.column,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to inspect column %s.%s: %w", m.table, m.column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)
+	if _, err := tx.Exec(stmt); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", m.table, m.column, err)
+	}
+	return nil
+}
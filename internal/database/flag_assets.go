@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"countryCurrency/internal/models"
+)
+
+const flagAssetColumns = "country_name, source_url, hash, content_type, size_bytes, etag, last_modified, fetched_at, changed_at"
+
+// GetFlagAsset returns the cached flag of the named country, or nil if there is none
+func (r *Repository) GetFlagAsset(name string) (*models.FlagAsset, error) {
+	query := "SELECT " + flagAssetColumns + " FROM flag_assets WHERE LOWER(country_name) = LOWER(?)"
+
+	a, err := scanFlagAsset(r.db.QueryRow(query, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get flag asset: %w", err)
+	}
+
+	return &a, nil
+}
+
+// GetFlagAssets returns every cached flag, keyed by country name
+func (r *Repository) GetFlagAssets() (map[string]models.FlagAsset, error) {
+	rows, err := r.db.Query("SELECT " + flagAssetColumns + " FROM flag_assets")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flag assets: %w", err)
+	}
+	defer rows.Close()
+
+	assets := map[string]models.FlagAsset{}
+	for rows.Next() {
+		a, err := scanFlagAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan flag asset: %w", err)
+		}
+		assets[a.CountryName] = a
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return assets, nil
+}
+
+// SaveFlagAsset inserts or replaces the cached flag of a country
+func (r *Repository) SaveFlagAsset(a *models.FlagAsset) error {
+	_, err := r.db.Exec(`
+		INSERT INTO flag_assets (`+flagAssetColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			source_url = VALUES(source_url),
+			hash = VALUES(hash),
+			content_type = VALUES(content_type),
+			size_bytes = VALUES(size_bytes),
+			etag = VALUES(etag),
+			last_modified = VALUES(last_modified),
+			fetched_at = VALUES(fetched_at),
+			changed_at = VALUES(changed_at)`,
+		a.CountryName, a.SourceURL, a.Hash, a.ContentType, a.SizeBytes, a.ETag, a.LastModified, a.FetchedAt, a.ChangedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save flag asset: %w", err)
+	}
+	return nil
+}
+
+// CountFlagAssetsByHash counts the countries whose cached flag has the given content
+func (r *Repository) CountFlagAssetsByHash(hash string) (int, error) {
+	var count int
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM flag_assets WHERE hash = ?", hash).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count flag assets: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteFlagAsset removes the cached flag of the named country and returns
+// it, or nil if there was none
+func (r *Repository) DeleteFlagAsset(name string) (*models.FlagAsset, error) {
+	asset, err := r.GetFlagAsset(name)
+	if err != nil || asset == nil {
+		return nil, err
+	}
+
+	if _, err := r.db.Exec("DELETE FROM flag_assets WHERE country_name = ?", asset.CountryName); err != nil {
+		return nil, fmt.Errorf("failed to delete flag asset: %w", err)
+	}
+	return asset, nil
+}
+
+// DeleteFlagAssetsExcept removes the cached flags of every country whose name
+// is not in names and returns them
+func (r *Repository) DeleteFlagAssetsExcept(names []string) ([]models.FlagAsset, error) {
+	placeholders, args := stringArgs(names)
+	where := " FROM flag_assets WHERE country_name NOT IN (" + placeholders + ")"
+
+	rows, err := r.db.Query("SELECT "+flagAssetColumns+where+" FOR UPDATE", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flag assets: %w", err)
+	}
+	defer rows.Close()
+
+	var assets []models.FlagAsset
+	for rows.Next() {
+		a, err := scanFlagAsset(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan flag asset: %w", err)
+		}
+		assets = append(assets, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if len(assets) == 0 {
+		return nil, nil
+	}
+
+	if _, err := r.db.Exec("DELETE"+where, args...); err != nil {
+		return nil, fmt.Errorf("failed to delete flag assets: %w", err)
+	}
+	return assets, nil
+}
+
+func scanFlagAsset(row rowScanner) (models.FlagAsset, error) {
+	var a models.FlagAsset
+	err := row.Scan(
+		&a.CountryName,
+		&a.SourceURL,
+		&a.Hash,
+		&a.ContentType,
+		&a.SizeBytes,
+		&a.ETag,
+		&a.LastModified,
+		&a.FetchedAt,
+		&a.ChangedAt,
+	)
+	return a, err
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Lease is a MySQL named lock (GET_LOCK) held on a dedicated connection.
+// MySQL releases the lock when that connection closes, so an instance that
+// dies cannot hold a lease forever.
+type Lease struct {
+	conn *sql.Conn
+	name string
+}
+
+// AcquireLease tries to take the named lock without waiting. The name is
+// scoped to the current database, so unrelated schemas on the same server
+// do not contend. It returns nil and no error when another session holds the lock.
+func (r *Repository) AcquireLease(ctx context.Context, name string) (*Lease, error) {
+	if r.conn == nil {
+		return nil, errors.New("leases cannot be acquired inside a transaction")
+	}
+
+	conn, err := r.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection for lease: %w", err)
+	}
+
+	var acquired sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(CONCAT(DATABASE(), ':', ?), 0)", name).Scan(&acquired)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, nil
+	}
+
+	return &Lease{conn: conn, name: name}, nil
+}
+
+// Alive checks that the connection holding the lease, and with it the lock, is still there
+func (l *Lease) Alive(ctx context.Context) error {
+	var held sql.NullInt64
+	err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(CONCAT(DATABASE(), ':', ?)) = CONNECTION_ID()", l.name).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("failed to check lease %s: %w", l.name, err)
+	}
+	if held.Int64 != 1 {
+		return fmt.Errorf("lease %s is no longer held", l.name)
+	}
+	return nil
+}
+
+// Release gives the lock back and returns the connection to the pool
+func (l *Lease) Release() error {
+	defer l.conn.Close()
+
+	if _, err := l.conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(CONCAT(DATABASE(), ':', ?))", l.name); err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", l.name, err)
+	}
+	return nil
+}
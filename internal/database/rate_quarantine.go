@@ -0,0 +1,165 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+const rateQuarantineColumns = "id, currency_code, old_rate, new_rate, change_pct, status, run_id, detected_at, resolved_at"
+
+// GetStoredRates returns the exchange rate currently stored for each currency code
+func (r *Repository) GetStoredRates() (map[string]float64, error) {
+	query := `
+		SELECT currency_code, MAX(exchange_rate)
+		FROM countries
+		WHERE currency_code IS NOT NULL AND exchange_rate IS NOT NULL AND deleted_at IS NULL
+		GROUP BY currency_code
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := map[string]float64{}
+	for rows.Next() {
+		var code string
+		var rate float64
+		if err := rows.Scan(&code, &rate); err != nil {
+			return nil, fmt.Errorf("failed to scan stored rate: %w", err)
+		}
+		rates[code] = rate
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return rates, nil
+}
+
+// SavePendingQuarantine records q as pending. A currency has at most one pending
+// entry, so an existing one is updated with the latest rate instead.
+func (r *Repository) SavePendingQuarantine(q *models.RateQuarantine) error {
+	var id int64
+	err := r.db.QueryRow(
+		"SELECT id FROM rate_quarantine WHERE currency_code = ? AND status = ? ORDER BY id DESC LIMIT 1",
+		q.CurrencyCode, models.QuarantinePending,
+	).Scan(&id)
+
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := r.db.Exec(`
+			INSERT INTO rate_quarantine (currency_code, old_rate, new_rate, change_pct, status, run_id, detected_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			q.CurrencyCode, q.OldRate, q.NewRate, q.ChangePct, models.QuarantinePending, q.RunID, q.DetectedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to quarantine rate: %w", err)
+		}
+		if q.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get last insert id: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to look up quarantined rate: %w", err)
+	default:
+		_, err := r.db.Exec(`
+			UPDATE rate_quarantine
+			SET old_rate = ?, new_rate = ?, change_pct = ?, run_id = ?, detected_at = ?
+			WHERE id = ?`,
+			q.OldRate, q.NewRate, q.ChangePct, q.RunID, q.DetectedAt, id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update quarantined rate: %w", err)
+		}
+		q.ID = id
+	}
+
+	q.Status = models.QuarantinePending
+	return nil
+}
+
+// GetQuarantinedRates lists quarantine entries, newest first. An empty status lists all of them.
+func (r *Repository) GetQuarantinedRates(status string) ([]models.RateQuarantine, error) {
+	query := "SELECT " + rateQuarantineColumns + " FROM rate_quarantine"
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined rates: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.RateQuarantine{}
+	for rows.Next() {
+		q, err := scanRateQuarantine(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined rate: %w", err)
+		}
+		entries = append(entries, q)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetQuarantinedRate returns the entry with the given ID, or nil if there is none.
+// Inside a transaction the row is locked until commit.
+func (r *Repository) GetQuarantinedRate(id int64) (*models.RateQuarantine, error) {
+	query := "SELECT " + rateQuarantineColumns + " FROM rate_quarantine WHERE id = ?"
+	if r.conn == nil {
+		query += " FOR UPDATE"
+	}
+
+	q, err := scanRateQuarantine(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarantined rate: %w", err)
+	}
+
+	return &q, nil
+}
+
+// ResolveQuarantine sets the final status of an entry
+func (r *Repository) ResolveQuarantine(id int64, status string, at time.Time) error {
+	_, err := r.db.Exec("UPDATE rate_quarantine SET status = ?, resolved_at = ? WHERE id = ?", status, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to resolve quarantined rate: %w", err)
+	}
+	return nil
+}
+
+// GetCountriesByCurrency returns the live countries using the given currency code
+func (r *Repository) GetCountriesByCurrency(code string) ([]models.Country, error) {
+	return r.GetAllCountries("", code, "", true)
+}
+
+func scanRateQuarantine(row rowScanner) (models.RateQuarantine, error) {
+	var q models.RateQuarantine
+	err := row.Scan(
+		&q.ID,
+		&q.CurrencyCode,
+		&q.OldRate,
+		&q.NewRate,
+		&q.ChangePct,
+		&q.Status,
+		&q.RunID,
+		&q.DetectedAt,
+		&q.ResolvedAt,
+	)
+	return q, err
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"countryCurrency/internal/models"
+)
+
+const refreshRunColumns = "id, trigger_source, scope, target, started_at, finished_at, outcome, error, rate_provider, sources, inserted, updated, unchanged, missing, failures, quarantined, rejections"
+
+// CreateRefreshRun inserts run and sets its ID
+func (r *Repository) CreateRefreshRun(run *models.RefreshRun) error {
+	query := `
+		INSERT INTO refresh_runs (trigger_source, scope, target, started_at, outcome, rate_provider)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.Exec(query, run.Trigger, run.Scope, nullString(run.Target), run.StartedAt, run.Outcome, run.RateProvider)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh run: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	run.ID = id
+
+	return nil
+}
+
+// FinishRefreshRun stores the final state of run
+func (r *Repository) FinishRefreshRun(run *models.RefreshRun) error {
+	sources, err := json.Marshal(run.Sources)
+	if err != nil {
+		return fmt.Errorf("failed to encode sources: %w", err)
+	}
+	failures, err := json.Marshal(run.Failed)
+	if err != nil {
+		return fmt.Errorf("failed to encode failures: %w", err)
+	}
+	rejections, err := json.Marshal(run.Rejected)
+	if err != nil {
+		return fmt.Errorf("failed to encode rejections: %w", err)
+	}
+
+	query := `
+		UPDATE refresh_runs
+		SET finished_at = ?, outcome = ?, error = ?, sources = ?,
+			inserted = ?, updated = ?, unchanged = ?, missing = ?, failed = ?, failures = ?, quarantined = ?,
+			rejected = ?, rejections = ?
+		WHERE id = ?
+	`
+
+	_, err = r.db.Exec(
+		query,
+		run.FinishedAt,
+		run.Outcome,
+		nullString(run.Error),
+		sources,
+		run.Inserted,
+		run.Updated,
+		run.Unchanged,
+		run.Missing,
+		len(run.Failed),
+		failures,
+		run.Quarantined,
+		len(run.Rejected),
+		rejections,
+		run.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to finish refresh run: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshRuns returns the most recent runs first
+func (r *Repository) GetRefreshRuns(limit int) ([]models.RefreshRun, error) {
+	query := "SELECT " + refreshRunColumns + " FROM refresh_runs ORDER BY id DESC LIMIT ?"
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refresh runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []models.RefreshRun{}
+	for rows.Next() {
+		run, err := scanRefreshRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return runs, nil
+}
+
+// GetRefreshRun returns the run with the given ID, or nil if there is none
+func (r *Repository) GetRefreshRun(id int64) (*models.RefreshRun, error) {
+	query := "SELECT " + refreshRunColumns + " FROM refresh_runs WHERE id = ?"
+
+	run, err := scanRefreshRun(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// GetRunningRefreshRun returns the most recent run that has not finished, or nil if there is none
+func (r *Repository) GetRunningRefreshRun() (*models.RefreshRun, error) {
+	query := "SELECT " + refreshRunColumns + " FROM refresh_runs WHERE outcome = ? ORDER BY id DESC LIMIT 1"
+
+	run, err := scanRefreshRun(r.db.QueryRow(query, models.OutcomeRunning))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+func scanRefreshRun(row rowScanner) (models.RefreshRun, error) {
+	var (
+		run              models.RefreshRun
+		runErr, provider sql.NullString
+		target           sql.NullString
+		sources, failed  []byte
+		rejections       []byte
+	)
+
+	err := row.Scan(
+		&run.ID,
+		&run.Trigger,
+		&run.Scope,
+		&target,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.Outcome,
+		&runErr,
+		&provider,
+		&sources,
+		&run.Inserted,
+		&run.Updated,
+		&run.Unchanged,
+		&run.Missing,
+		&failed,
+		&run.Quarantined,
+		&rejections,
+	)
+	if err == sql.ErrNoRows {
+		return run, err
+	}
+	if err != nil {
+		return run, fmt.Errorf("failed to scan refresh run: %w", err)
+	}
+
+	run.Error = runErr.String
+	run.Target = target.String
+	run.RateProvider = provider.String
+
+	run.Sources = []models.SourceFetch{}
+	if len(sources) > 0 {
+		if err := json.Unmarshal(sources, &run.Sources); err != nil {
+			return run, fmt.Errorf("failed to decode sources: %w", err)
+		}
+	}
+	run.Failed = []models.RowFailure{}
+	if len(failed) > 0 {
+		if err := json.Unmarshal(failed, &run.Failed); err != nil {
+			return run, fmt.Errorf("failed to decode failures: %w", err)
+		}
+	}
+	run.Rejected = []models.Rejection{}
+	if len(rejections) > 0 {
+		if err := json.Unmarshal(rejections, &run.Rejected); err != nil {
+			return run, fmt.Errorf("failed to decode rejections: %w", err)
+		}
+	}
+
+	return run, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -1,19 +1,79 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"countryCurrency/internal/models"
 )
 
+// dbtx is satisfied by both *sql.DB and *sql.Tx
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 type Repository struct {
-	db *sql.DB
+	conn *sql.DB
+	db   dbtx
+}
+
+// countryColumns is the column list scanned by scanCountry
+const countryColumns = "id, name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at, stale_since"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCountry(row rowScanner) (models.Country, error) {
+	var c models.Country
+	err := row.Scan(
+		&c.ID,
+		&c.Name,
+		&c.Capital,
+		&c.Region,
+		&c.Population,
+		&c.CurrencyCode,
+		&c.ExchangeRate,
+		&c.EstimatedGDP,
+		&c.FlagURL,
+		&c.LastRefreshedAt,
+		&c.StaleSince,
+	)
+	return c, err
 }
 
 func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+	return &Repository{conn: db, db: db}
+}
+
+// WithTx runs fn against a Repository bound to a single transaction.
+// The transaction is committed when fn returns nil and rolled back otherwise.
+// Calling WithTx on a transactional Repository reuses the open transaction.
+func (r *Repository) WithTx(ctx context.Context, fn func(tx *Repository) error) error {
+	if r.conn == nil {
+		return fn(r)
+	}
+
+	tx, err := r.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(&Repository{db: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 func (r *Repository) UpsertCountry(country *models.Country) error {
@@ -28,7 +88,10 @@ func (r *Repository) UpsertCountry(country *models.Country) error {
 			exchange_rate = VALUES(exchange_rate),
 			estimated_gdp = VALUES(estimated_gdp),
 			flag_url = VALUES(flag_url),
-			last_refreshed_at = VALUES(last_refreshed_at)
+			last_refreshed_at = VALUES(last_refreshed_at),
+			stale_since = NULL,
+			deleted_at = NULL,
+			id = LAST_INSERT_ID(id)
 	`
 
 	result, err := r.db.Exec(
@@ -48,7 +111,8 @@ func (r *Repository) UpsertCountry(country *models.Country) error {
 		return fmt.Errorf("failed to upsert country: %w", err)
 	}
 
-	// Get the last insert ID
+	// LAST_INSERT_ID(id) in the update clause makes this the existing row's ID
+	// on updates, not just on inserts
 	id, err := result.LastInsertId()
 	if err != nil {
 		return fmt.Errorf("failed to get last insert id: %w", err)
@@ -58,11 +122,253 @@ func (r *Repository) UpsertCountry(country *models.Country) error {
 	return nil
 }
 
-func (r *Repository) GetAllCountries(region, currency, sort string) ([]models.Country, error) {
+// BulkUpsertCountries writes countries with multi-row INSERT ... ON DUPLICATE KEY UPDATE
+// statements of at most chunkSize rows. Each country gets its row ID, and each row
+// is counted as inserted, updated or unchanged against the data stored before.
+// If a chunk statement fails, that chunk is retried row by row, and rows that
+// still fail are reported in Failed instead of aborting the whole call.
+func (r *Repository) BulkUpsertCountries(countries []models.Country, chunkSize int) (models.UpsertStats, error) {
+	stats := models.UpsertStats{Failed: []models.RowFailure{}}
+	if chunkSize <= 0 {
+		chunkSize = len(countries)
+	}
+
+	for start := 0; start < len(countries); start += chunkSize {
+		chunk := countries[start:min(start+chunkSize, len(countries))]
+
+		existing, err := r.getCountriesByNames(chunk)
+		if err != nil {
+			return stats, err
+		}
+
+		written := chunk
+		if err := r.upsertChunk(chunk); err != nil {
+			written = nil
+			for i := range chunk {
+				if err := r.UpsertCountry(&chunk[i]); err != nil {
+					stats.Failed = append(stats.Failed, models.RowFailure{Name: chunk[i].Name, Error: err.Error()})
+					continue
+				}
+				written = append(written, chunk[i])
+			}
+		}
+
+		for _, country := range written {
+			old, ok := existing[strings.ToLower(country.Name)]
+			switch {
+			case !ok:
+				stats.Inserted++
+			case old.SameSourceData(country):
+				stats.Unchanged++
+			default:
+				stats.Updated++
+			}
+		}
+
+		ids, err := r.getIDsByNames(chunk)
+		if err != nil {
+			return stats, err
+		}
+		for i := range chunk {
+			if id, ok := ids[strings.ToLower(chunk[i].Name)]; ok {
+				chunk[i].ID = id
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+func (r *Repository) upsertChunk(chunk []models.Country) error {
+	var query strings.Builder
+	query.WriteString("INSERT INTO countries (name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at) VALUES ")
+
+	args := make([]interface{}, 0, len(chunk)*9)
+	for i, country := range chunk {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args,
+			country.Name,
+			country.Capital,
+			country.Region,
+			country.Population,
+			country.CurrencyCode,
+			country.ExchangeRate,
+			country.EstimatedGDP,
+			country.FlagURL,
+			country.LastRefreshedAt,
+		)
+	}
+
+	query.WriteString(`
+		ON DUPLICATE KEY UPDATE
+			capital = VALUES(capital),
+			region = VALUES(region),
+			population = VALUES(population),
+			currency_code = VALUES(currency_code),
+			exchange_rate = VALUES(exchange_rate),
+			estimated_gdp = VALUES(estimated_gdp),
+			flag_url = VALUES(flag_url),
+			last_refreshed_at = VALUES(last_refreshed_at),
+			stale_since = NULL,
+			deleted_at = NULL`)
+
+	if _, err := r.db.Exec(query.String(), args...); err != nil {
+		return fmt.Errorf("failed to upsert countries: %w", err)
+	}
+	return nil
+}
+
+// getCountriesByNames returns the stored rows matching the names in chunk, keyed by lower-cased name
+func (r *Repository) getCountriesByNames(chunk []models.Country) (map[string]models.Country, error) {
+	placeholders, args := nameArgs(chunk)
+	query := `
+		SELECT ` + countryColumns + `
+		FROM countries
+		WHERE name IN (` + placeholders + `)`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query existing countries: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]models.Country, len(chunk))
+	for rows.Next() {
+		c, err := scanCountry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan country: %w", err)
+		}
+		existing[strings.ToLower(c.Name)] = c
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return existing, nil
+}
+
+// getIDsByNames returns the row IDs of the names in chunk, keyed by lower-cased name
+func (r *Repository) getIDsByNames(chunk []models.Country) (map[string]int64, error) {
+	placeholders, args := nameArgs(chunk)
+	rows, err := r.db.Query("SELECT id, name FROM countries WHERE name IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query country ids: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int64, len(chunk))
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("failed to scan country id: %w", err)
+		}
+		ids[strings.ToLower(name)] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+func nameArgs(chunk []models.Country) (string, []interface{}) {
+	names := make([]string, len(chunk))
+	for i, country := range chunk {
+		names[i] = country.Name
+	}
+	return stringArgs(names)
+}
+
+// stringArgs returns an IN (...) placeholder list and its arguments
+func stringArgs(values []string) (string, []interface{}) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "), args
+}
+
+// UpdateCountryRates writes the exchange rate and estimated GDP of countries,
+// matched by ID, in chunks of at most chunkSize rows. Other columns are left alone.
+func (r *Repository) UpdateCountryRates(countries []models.Country, chunkSize int, at time.Time) error {
+	if chunkSize <= 0 {
+		chunkSize = len(countries)
+	}
+
+	for start := 0; start < len(countries); start += chunkSize {
+		chunk := countries[start:min(start+chunkSize, len(countries))]
+
+		var rateCases, gdpCases strings.Builder
+		rateArgs := make([]interface{}, 0, len(chunk)*2)
+		gdpArgs := make([]interface{}, 0, len(chunk)*2)
+		ids := make([]interface{}, len(chunk))
+		for i, country := range chunk {
+			rateCases.WriteString(" WHEN ? THEN ?")
+			gdpCases.WriteString(" WHEN ? THEN ?")
+			rateArgs = append(rateArgs, country.ID, country.ExchangeRate)
+			gdpArgs = append(gdpArgs, country.ID, country.EstimatedGDP)
+			ids[i] = country.ID
+		}
+
+		query := "UPDATE countries SET exchange_rate = CASE id" + rateCases.String() + " END," +
+			" estimated_gdp = CASE id" + gdpCases.String() + " END," +
+			" last_refreshed_at = ?" +
+			" WHERE id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ") + ")"
+
+		args := append(rateArgs, gdpArgs...)
+		args = append(args, at)
+		args = append(args, ids...)
+
+		if _, err := r.db.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to update country rates: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MarkCountriesStale stamps stale_since on every live country whose name is not in seen.
+// Countries already marked keep their original stale_since.
+func (r *Repository) MarkCountriesStale(seen []string, at time.Time) (int64, error) {
+	placeholders, args := stringArgs(seen)
+	query := "UPDATE countries SET stale_since = ? WHERE stale_since IS NULL AND deleted_at IS NULL AND name NOT IN (" + placeholders + ")"
 
-	query := "SELECT id, name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at FROM countries WHERE 1=1"
+	result, err := r.db.Exec(query, append([]interface{}{at}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark stale countries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// SoftDeleteCountries stamps deleted_at on every live country whose name is not in seen
+func (r *Repository) SoftDeleteCountries(seen []string, at time.Time) (int64, error) {
+	placeholders, args := stringArgs(seen)
+	query := "UPDATE countries SET deleted_at = ? WHERE deleted_at IS NULL AND name NOT IN (" + placeholders + ")"
+
+	result, err := r.db.Exec(query, append([]interface{}{at}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to soft-delete countries: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetAllCountries lists countries that are not soft-deleted. Countries missing
+// from the upstream feed are only included when includeStale is set.
+func (r *Repository) GetAllCountries(region, currency, sort string, includeStale bool) ([]models.Country, error) {
+
+	query := "SELECT " + countryColumns + " FROM countries WHERE deleted_at IS NULL"
 	args := []interface{}{}
 
+	if !includeStale {
+		query += " AND stale_since IS NULL"
+	}
+
 	// Add region filter if provided
 	if region != "" {
 		query += " AND LOWER(region) = LOWER(?)"
@@ -100,19 +406,7 @@ func (r *Repository) GetAllCountries(region, currency, sort string) ([]models.Co
 
 	countries := []models.Country{}
 	for rows.Next() {
-		var c models.Country
-		err := rows.Scan(
-			&c.ID,
-			&c.Name,
-			&c.Capital,
-			&c.Region,
-			&c.Population,
-			&c.CurrencyCode,
-			&c.ExchangeRate,
-			&c.EstimatedGDP,
-			&c.FlagURL,
-			&c.LastRefreshedAt,
-		)
+		c, err := scanCountry(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan country: %w", err)
 		}
@@ -129,24 +423,12 @@ func (r *Repository) GetAllCountries(region, currency, sort string) ([]models.Co
 
 func (r *Repository) GetCountryByName(name string) (*models.Country, error) {
 	query := `
-		SELECT id, name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at
+		SELECT ` + countryColumns + `
 		FROM countries
-		WHERE LOWER(name) = LOWER(?)
+		WHERE LOWER(name) = LOWER(?) AND deleted_at IS NULL
 	`
 
-	var c models.Country
-	err := r.db.QueryRow(query, name).Scan(
-		&c.ID,
-		&c.Name,
-		&c.Capital,
-		&c.Region,
-		&c.Population,
-		&c.CurrencyCode,
-		&c.ExchangeRate,
-		&c.EstimatedGDP,
-		&c.FlagURL,
-		&c.LastRefreshedAt,
-	)
+	c, err := scanCountry(r.db.QueryRow(query, name))
 
 	if err == sql.ErrNoRows {
 		return nil, nil // Not found, return nil (not an error)
@@ -178,10 +460,11 @@ func (r *Repository) DeleteCountryByName(name string) error {
 	return nil
 }
 
-// GetTotalCountries returns the count of all countries
+// GetTotalCountries counts the countries GetAllCountries lists by default,
+// leaving out soft-deleted and stale ones
 func (r *Repository) GetTotalCountries() (int, error) {
 	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM countries").Scan(&count)
+	err := r.db.QueryRow("SELECT COUNT(*) FROM countries WHERE deleted_at IS NULL AND stale_since IS NULL").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count countries: %w", err)
 	}
@@ -213,16 +496,34 @@ func (r *Repository) UpdateLastRefreshedAt() error {
 	return nil
 }
 
-func (r *Repository) GetTopCountriesByGDP(limit int) ([]models.Country, error) {
-	query := `
-		SELECT id, name, capital, region, population, currency_code, exchange_rate, estimated_gdp, flag_url, last_refreshed_at
-		FROM countries
-		WHERE estimated_gdp IS NOT NULL
-		ORDER BY estimated_gdp DESC
-		LIMIT ?
-	`
+// metricExpressions maps each image metric to the expression countries are ranked by
+var metricExpressions = map[string]string{
+	models.MetricGDP:          "estimated_gdp",
+	models.MetricPopulation:   "population",
+	models.MetricGDPPerCapita: "estimated_gdp / NULLIF(population, 0)",
+	models.MetricExchangeRate: "exchange_rate",
+}
 
-	rows, err := r.db.Query(query, limit)
+// GetTopCountriesByMetric returns the limit current countries with the highest
+// value of metric, optionally within region. Countries without a value are left out.
+func (r *Repository) GetTopCountriesByMetric(metric, region string, limit int) ([]models.Country, error) {
+	expr, ok := metricExpressions[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+
+	query := "SELECT " + countryColumns + " FROM countries WHERE deleted_at IS NULL AND stale_since IS NULL AND " + expr + " IS NOT NULL"
+	args := []interface{}{}
+
+	if region != "" {
+		query += " AND LOWER(region) = LOWER(?)"
+		args = append(args, region)
+	}
+
+	query += " ORDER BY " + expr + " DESC, name ASC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query top countries: %w", err)
 	}
@@ -230,19 +531,7 @@ func (r *Repository) GetTopCountriesByGDP(limit int) ([]models.Country, error) {
 
 	countries := []models.Country{}
 	for rows.Next() {
-		var c models.Country
-		err := rows.Scan(
-			&c.ID,
-			&c.Name,
-			&c.Capital,
-			&c.Region,
-			&c.Population,
-			&c.CurrencyCode,
-			&c.ExchangeRate,
-			&c.EstimatedGDP,
-			&c.FlagURL,
-			&c.LastRefreshedAt,
-		)
+		c, err := scanCountry(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan country: %w", err)
 		}
@@ -256,3 +545,33 @@ func (r *Repository) GetTopCountriesByGDP(limit int) ([]models.Country, error) {
 
 	return countries, nil
 }
+
+// GetTotalCountriesInRegion counts the live, non-stale countries of region
+func (r *Repository) GetTotalCountriesInRegion(region string) (int, error) {
+	var count int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM countries WHERE deleted_at IS NULL AND stale_since IS NULL AND LOWER(region) = LOWER(?)", region).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count countries: %w", err)
+	}
+	return count, nil
+}
+
+// GetDataVersion returns a string that changes whenever countries are
+// written, deleted, flagged stale or refreshed
+func (r *Repository) GetDataVersion() (string, error) {
+	query := `
+		SELECT CONCAT_WS('/',
+			COUNT(*),
+			COALESCE(MAX(last_refreshed_at), ''),
+			COALESCE(MAX(stale_since), ''),
+			COALESCE(MAX(deleted_at), ''),
+			(SELECT updated_at FROM metadata WHERE ` + "`key`" + ` = 'last_refreshed_at'))
+		FROM countries
+	`
+
+	var version string
+	if err := r.db.QueryRow(query).Scan(&version); err != nil {
+		return "", fmt.Errorf("failed to get data version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+// errRollback makes WithTx discard the benchmark writes
+var errRollback = errors.New("rollback")
+
+// openTestRepository connects to the MySQL database named by TEST_DATABASE_DSN,
+// e.g. root:secret@tcp(localhost:3306)/country_currency_test?parseTime=true,
+// and skips the calling test or benchmark when it is not set
+func openTestRepository(tb testing.TB) *Repository {
+	tb.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		tb.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		tb.Fatalf("failed to open database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		tb.Fatalf("failed to ping database: %v", err)
+	}
+	if err := runMigrations(db); err != nil {
+		tb.Fatalf("failed to run migrations: %v", err)
+	}
+
+	return NewRepository(db)
+}
+
+// BenchmarkBulkUpsertCountries compares the row-by-row UpsertCountry path with
+// BulkUpsertCountries. Every iteration runs inside a transaction that is
+// rolled back, so the countries table is left untouched.
+func BenchmarkBulkUpsertCountries(b *testing.B) {
+	repo := openTestRepository(b)
+	ctx := context.Background()
+
+	const rows, batchSize = 250, 100
+
+	b.Run("UpsertCountry", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			countries := syntheticCountries(rows)
+			err := repo.WithTx(ctx, func(tx *Repository) error {
+				for j := range countries {
+					if err := tx.UpsertCountry(&countries[j]); err != nil {
+						return err
+					}
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("BulkUpsertCountries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			countries := syntheticCountries(rows)
+			err := repo.WithTx(ctx, func(tx *Repository) error {
+				if _, err := tx.BulkUpsertCountries(countries, batchSize); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func syntheticCountries(n int) []models.Country {
+	now := time.Now()
+	region := "Benchmark"
+	currency := "XXX"
+	countries := make([]models.Country, n)
+	for i := range countries {
+		rate := float64(i + 1)
+		gdp := float64(i) * 1000
+		countries[i] = models.Country{
+			Name:            fmt.Sprintf("zz-upsertbench-%04d", i),
+			Region:          &region,
+			Population:      int64(i) * 1000,
+			CurrencyCode:    &currency,
+			ExchangeRate:    &rate,
+			EstimatedGDP:    &gdp,
+			LastRefreshedAt: now,
+		}
+	}
+	return countries
+}
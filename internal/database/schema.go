@@ -13,6 +13,8 @@ const (
 			estimated_gdp DOUBLE,
 			flag_url TEXT,
 			last_refreshed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			stale_since DATETIME NULL,
+			deleted_at DATETIME NULL,
 			INDEX idx_region (region),
 			INDEX idx_currency (currency_code)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -27,7 +29,122 @@ const (
 		`
 )
 
+const CreateRefreshRunsTable = `
+		CREATE TABLE IF NOT EXISTS refresh_runs (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			trigger_source VARCHAR(32) NOT NULL,
+			scope VARCHAR(64) NOT NULL DEFAULT 'all',
+			target VARCHAR(255) NULL,
+			started_at DATETIME(3) NOT NULL,
+			finished_at DATETIME(3) NULL,
+			outcome VARCHAR(16) NOT NULL,
+			error TEXT,
+			rate_provider VARCHAR(255),
+			sources JSON,
+			inserted INT NOT NULL DEFAULT 0,
+			updated INT NOT NULL DEFAULT 0,
+			unchanged INT NOT NULL DEFAULT 0,
+			missing INT NOT NULL DEFAULT 0,
+			failed INT NOT NULL DEFAULT 0,
+			failures JSON,
+			quarantined INT NOT NULL DEFAULT 0,
+			rejected INT NOT NULL DEFAULT 0,
+			rejections JSON,
+			INDEX idx_started_at (started_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+		`
+
+const CreateRateQuarantineTable = `
+		CREATE TABLE IF NOT EXISTS rate_quarantine (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			currency_code VARCHAR(10) NOT NULL,
+			old_rate DOUBLE NOT NULL,
+			new_rate DOUBLE NOT NULL,
+			change_pct DOUBLE NOT NULL,
+			status VARCHAR(16) NOT NULL,
+			run_id BIGINT NULL,
+			detected_at DATETIME(3) NOT NULL,
+			resolved_at DATETIME(3) NULL,
+			INDEX idx_status (status),
+			INDEX idx_currency (currency_code)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+		`
+
+const CreateSummaryImagesTable = `
+		CREATE TABLE IF NOT EXISTS summary_images (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			run_id BIGINT NOT NULL,
+			hash CHAR(64) NOT NULL,
+			format VARCHAR(8) NOT NULL,
+			size_bytes INT NOT NULL,
+			created_at DATETIME(3) NOT NULL,
+			INDEX idx_run (run_id),
+			INDEX idx_hash (hash),
+			INDEX idx_created (created_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+		`
+
+const CreateCountrySnapshotsTable = `
+		CREATE TABLE IF NOT EXISTS country_snapshots (
+			run_id BIGINT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			region VARCHAR(255),
+			population BIGINT NOT NULL,
+			exchange_rate DOUBLE,
+			estimated_gdp DOUBLE,
+			captured_at DATETIME(3) NOT NULL,
+			PRIMARY KEY (run_id, name),
+			INDEX idx_captured (captured_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+		`
+
+const CreateFlagAssetsTable = `
+		CREATE TABLE IF NOT EXISTS flag_assets (
+			country_name VARCHAR(255) NOT NULL PRIMARY KEY,
+			source_url VARCHAR(1024) NOT NULL,
+			hash CHAR(64) NOT NULL,
+			content_type VARCHAR(64) NOT NULL,
+			size_bytes INT NOT NULL,
+			etag VARCHAR(255) NOT NULL DEFAULT '',
+			last_modified VARCHAR(64) NOT NULL DEFAULT '',
+			fetched_at DATETIME(3) NOT NULL,
+			changed_at DATETIME(3) NOT NULL,
+			INDEX idx_hash (hash)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+		`
+
+// CreateUpstreamValidatorsTable keeps the validators of applied upstream
+// responses. They are written in the transaction that applies the response,
+// so a rolled back refresh fetches the same data again next time.
+const CreateUpstreamValidatorsTable = `
+		CREATE TABLE IF NOT EXISTS upstream_validators (
+			source VARCHAR(64) NOT NULL PRIMARY KEY,
+			url VARCHAR(1024) NOT NULL,
+			etag VARCHAR(255) NOT NULL DEFAULT '',
+			last_modified VARCHAR(64) NOT NULL DEFAULT '',
+			body_hash CHAR(64) NOT NULL,
+			updated_at DATETIME(3) NOT NULL
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+		`
+
 const InitialMetadata = `
 		INSERT IGNORE INTO metadata(` + "`key`" + `, value)
 		VALUES ('last_refreshed_at', NOW());
 		`
+
+// columnMigration adds a column to a table created before the column existed
+type columnMigration struct {
+	table      string
+	column     string
+	definition string
+}
+
+var columnMigrations = []columnMigration{
+	{"countries", "stale_since", "DATETIME NULL"},
+	{"countries", "deleted_at", "DATETIME NULL"},
+	{"refresh_runs", "scope", "VARCHAR(64) NOT NULL DEFAULT 'all'"},
+	{"refresh_runs", "target", "VARCHAR(255) NULL"},
+	{"refresh_runs", "quarantined", "INT NOT NULL DEFAULT 0"},
+	{"refresh_runs", "rejected", "INT NOT NULL DEFAULT 0"},
+	{"refresh_runs", "rejections", "JSON"},
+}
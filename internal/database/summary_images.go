@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+const summaryImageColumns = "id, run_id, hash, format, size_bytes, created_at"
+
+// InsertSummaryImage records img in the history and sets its ID
+func (r *Repository) InsertSummaryImage(img *models.SummaryImage) error {
+	result, err := r.db.Exec(
+		"INSERT INTO summary_images (run_id, hash, format, size_bytes, created_at) VALUES (?, ?, ?, ?, ?)",
+		img.RunID, img.Hash, img.Format, img.SizeBytes, img.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert summary image: %w", err)
+	}
+
+	if img.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	return nil
+}
+
+// GetSummaryImages returns the most recent images in the history, newest first
+func (r *Repository) GetSummaryImages(limit int) ([]models.SummaryImage, error) {
+	query := "SELECT " + summaryImageColumns + " FROM summary_images ORDER BY id DESC LIMIT ?"
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query summary images: %w", err)
+	}
+	defer rows.Close()
+
+	images := []models.SummaryImage{}
+	for rows.Next() {
+		img, err := scanSummaryImage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan summary image: %w", err)
+		}
+		images = append(images, img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return images, nil
+}
+
+// GetSummaryImageByRun returns the last image generated by a refresh run, or
+// nil if the run has none
+func (r *Repository) GetSummaryImageByRun(runID int64) (*models.SummaryImage, error) {
+	query := "SELECT " + summaryImageColumns + " FROM summary_images WHERE run_id = ? ORDER BY id DESC LIMIT 1"
+
+	img, err := scanSummaryImage(r.db.QueryRow(query, runID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get summary image: %w", err)
+	}
+
+	return &img, nil
+}
+
+// PruneSummaryImages deletes history entries beyond the newest keep, or
+// created before cutoff. A zero keep or cutoff disables that rule. It returns
+// the deleted images whose content no remaining entry shares, so their files
+// can be removed.
+func (r *Repository) PruneSummaryImages(keep int, cutoff time.Time) ([]models.SummaryImage, error) {
+	var conds []string
+	var args []interface{}
+
+	if !cutoff.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, cutoff)
+	}
+	if keep > 0 {
+		var boundary int64
+		err := r.db.QueryRow("SELECT id FROM summary_images ORDER BY id DESC LIMIT 1 OFFSET ?", keep).Scan(&boundary)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, fmt.Errorf("failed to find retention boundary: %w", err)
+		default:
+			conds = append(conds, "id <= ?")
+			args = append(args, boundary)
+		}
+	}
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	where := strings.Join(conds, " OR ")
+
+	rows, err := r.db.Query("SELECT "+summaryImageColumns+" FROM summary_images WHERE "+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired summary images: %w", err)
+	}
+	expired := map[string]models.SummaryImage{}
+	for rows.Next() {
+		img, err := scanSummaryImage(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan summary image: %w", err)
+		}
+		expired[img.Hash] = img
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	if _, err := r.db.Exec("DELETE FROM summary_images WHERE "+where, args...); err != nil {
+		return nil, fmt.Errorf("failed to prune summary images: %w", err)
+	}
+
+	placeholders := make([]string, 0, len(expired))
+	hashes := make([]interface{}, 0, len(expired))
+	for hash := range expired {
+		placeholders = append(placeholders, "?")
+		hashes = append(hashes, hash)
+	}
+
+	kept, err := r.db.Query("SELECT DISTINCT hash FROM summary_images WHERE hash IN ("+strings.Join(placeholders, ", ")+")", hashes...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query kept summary images: %w", err)
+	}
+	defer kept.Close()
+	for kept.Next() {
+		var hash string
+		if err := kept.Scan(&hash); err != nil {
+			return nil, fmt.Errorf("failed to scan summary image hash: %w", err)
+		}
+		delete(expired, hash)
+	}
+	if err := kept.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	orphaned := make([]models.SummaryImage, 0, len(expired))
+	for _, img := range expired {
+		orphaned = append(orphaned, img)
+	}
+	return orphaned, nil
+}
+
+func scanSummaryImage(row rowScanner) (models.SummaryImage, error) {
+	var img models.SummaryImage
+	err := row.Scan(
+		&img.ID,
+		&img.RunID,
+		&img.Hash,
+		&img.Format,
+		&img.SizeBytes,
+		&img.CreatedAt,
+	)
+	return img, err
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"countryCurrency/internal/models"
+)
+
+// GetUpstreamValidator returns the validators of the last applied response
+// from source, or nil if there are none
+func (r *Repository) GetUpstreamValidator(source string) (*models.UpstreamValidator, error) {
+	var v models.UpstreamValidator
+	err := r.db.QueryRow(`
+		SELECT source, url, etag, last_modified, body_hash, updated_at
+		FROM upstream_validators WHERE source = ?`, source,
+	).Scan(&v.Source, &v.URL, &v.ETag, &v.LastModified, &v.BodyHash, &v.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upstream validator: %w", err)
+	}
+
+	return &v, nil
+}
+
+// SaveUpstreamValidator inserts or replaces the validators of a source. Call
+// it in the transaction that applies the response they describe.
+func (r *Repository) SaveUpstreamValidator(v *models.UpstreamValidator) error {
+	_, err := r.db.Exec(`
+		INSERT INTO upstream_validators (source, url, etag, last_modified, body_hash, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			url = VALUES(url),
+			etag = VALUES(etag),
+			last_modified = VALUES(last_modified),
+			body_hash = VALUES(body_hash),
+			updated_at = VALUES(updated_at)`,
+		v.Source, v.URL, v.ETag, v.LastModified, v.BodyHash, v.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save upstream validator: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"bytes"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -16,20 +22,153 @@ type CountryHandler struct {
 	repo           *database.Repository
 	countryService *services.CountryService
 	imageService   *services.ImageService
+	flags          *services.FlagCache
+	refreshJobs    *services.RefreshJobs
 }
 
-func NewCountryHandler(repo *database.Repository, countryService *services.CountryService, imageService *services.ImageService) *CountryHandler {
+func NewCountryHandler(repo *database.Repository, countryService *services.CountryService, imageService *services.ImageService, flags *services.FlagCache, refreshJobs *services.RefreshJobs) *CountryHandler {
 	return &CountryHandler{
 		repo:           repo,
 		countryService: countryService,
 		imageService:   imageService,
+		flags:          flags,
+		refreshJobs:    refreshJobs,
 	}
 }
 
+// RefreshCountries starts a background refresh and answers 202 Accepted with
+// the job's location. A refresh already in flight is shared rather than
+// started twice. With ?wait=true it waits for the refresh to finish and
+// answers like a synchronous refresh. ?scope=rates refreshes exchange rates
+// only, and ?region= refreshes the countries of a single region.
 func (h *CountryHandler) RefreshCountries(c *gin.Context) {
-	ctx := c.Request.Context()
+	scope := c.DefaultQuery("scope", models.ScopeAll)
+	if scope != models.ScopeAll && scope != models.ScopeRates {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Validation failed",
+			Details: models.ValidationErrorDetails{
+				"scope": "must be all or rates",
+			},
+		})
+		return
+	}
+
+	opts := services.RefreshOptions{Trigger: models.TriggerAPI, Scope: scope}
+	if region := c.Query("region"); region != "" {
+		if scope == models.ScopeRates {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"region": "cannot be combined with scope=rates",
+				},
+			})
+			return
+		}
+		opts.Scope = models.ScopeRegion
+		opts.Target = region
+	}
+
+	h.startRefresh(c, opts)
+}
+
+// RefreshCountry refreshes a single country from the upstream per-name endpoint
+func (h *CountryHandler) RefreshCountry(c *gin.Context) {
+	name := c.Param("name")
+
+	if name == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Validation failed",
+			Details: models.ValidationErrorDetails{
+				"name": "is required",
+			},
+		})
+		return
+	}
+
+	h.startRefresh(c, services.RefreshOptions{Trigger: models.TriggerAPI, Scope: models.ScopeCountry, Target: name})
+}
+
+// RefreshRates refreshes exchange rates and estimated GDP without touching country metadata
+func (h *CountryHandler) RefreshRates(c *gin.Context) {
+	h.startRefresh(c, services.RefreshOptions{Trigger: models.TriggerAPI, Scope: models.ScopeRates})
+}
+
+func (h *CountryHandler) startRefresh(c *gin.Context, opts services.RefreshOptions) {
+	if raw := c.Query("dry_run"); raw != "" {
+		dryRun, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"dry_run": "must be true or false",
+				},
+			})
+			return
+		}
+		if dryRun {
+			h.dryRun(c, opts)
+			return
+		}
+	}
+
+	wait := false
+	if raw := c.Query("wait"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"wait": "must be true or false",
+				},
+			})
+			return
+		}
+		wait = parsed
+	}
 
-	if err := h.countryService.RefreshCountries(ctx); err != nil {
+	job, err := h.refreshJobs.Start(c.Request.Context(), opts)
+	if errors.Is(err, services.ErrRefreshBusy) {
+		c.Header("Location", "/refresh/jobs/"+job.ID)
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Refresh already in progress",
+			Details: gin.H{"reason": err.Error(), "job": job},
+		})
+		return
+	}
+	if errors.Is(err, services.ErrRefreshRunningElsewhere) {
+		h.refreshConflict(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if !wait {
+		c.Header("Location", "/refresh/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, job)
+		return
+	}
+
+	job, err = h.refreshJobs.Wait(c.Request.Context(), job.ID)
+	if errors.Is(err, services.ErrNoMatchingCountries) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Country not found",
+			Details: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrRefreshAborted) {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Refresh aborted",
+			Details: gin.H{"reason": err.Error(), "run": job.Result},
+		})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
 			Error:   "External data source unavailable",
 			Details: err.Error(),
@@ -37,10 +176,63 @@ func (h *CountryHandler) RefreshCountries(c *gin.Context) {
 		return
 	}
 
+	message := "Countries refreshed successfully"
+	switch job.Scope {
+	case models.ScopeRates:
+		message = "Exchange rates refreshed successfully"
+	case models.ScopeCountry, models.ScopeRegion:
+		message = fmt.Sprintf("Countries matching %s %q refreshed successfully", job.Scope, job.Target)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Countries refreshed successfully",
+		"message": message,
+		"run":     job.Result,
+	})
+}
+
+// dryRun answers with what the refresh described by opts would change, without writing anything
+func (h *CountryHandler) dryRun(c *gin.Context, opts services.RefreshOptions) {
+	diff, err := h.countryService.DryRun(c.Request.Context(), opts)
+	if errors.Is(err, services.ErrNoMatchingCountries) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error:   "Country not found",
+			Details: err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, services.ErrRefreshAborted) {
+		c.JSON(http.StatusUnprocessableEntity, models.ErrorResponse{
+			Error:   "Refresh would abort",
+			Details: gin.H{"reason": err.Error(), "diff": diff},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error:   "External data source unavailable",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// refreshConflict answers 409 when another instance is refreshing, pointing
+// at that instance's run record when one can be found
+func (h *CountryHandler) refreshConflict(c *gin.Context, err error) {
+	details := gin.H{"reason": err.Error()}
+
+	run, lookupErr := h.repo.GetRunningRefreshRun()
+	if lookupErr == nil && run != nil {
+		c.Header("Location", fmt.Sprintf("/refresh/runs/%d", run.ID))
+		details["run"] = run
+	}
+
+	c.JSON(http.StatusConflict, models.ErrorResponse{
+		Error:   "Refresh already in progress",
+		Details: details,
 	})
-	return
 }
 
 func (h *CountryHandler) GetAllCountries(c *gin.Context) {
@@ -48,7 +240,22 @@ func (h *CountryHandler) GetAllCountries(c *gin.Context) {
 	currency := c.Query("currency")
 	sort := c.Query("sort")
 
-	countries, err := h.repo.GetAllCountries(region, currency, sort)
+	includeStale := false
+	if raw := c.Query("include_stale"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"include_stale": "must be true or false",
+				},
+			})
+			return
+		}
+		includeStale = parsed
+	}
+
+	countries, err := h.repo.GetAllCountries(region, currency, sort, includeStale)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error:   "Internal server error",
@@ -61,6 +268,14 @@ func (h *CountryHandler) GetAllCountries(c *gin.Context) {
 		countries = []models.Country{}
 	}
 
+	if err := h.flags.Localize(countries); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, countries)
 }
 
@@ -93,7 +308,43 @@ func (h *CountryHandler) GetCountryByName(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, country)
+	countries := []models.Country{*country}
+	if err := h.flags.Localize(countries); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, countries[0])
+}
+
+// GetCountryFlag serves the locally cached flag of a country. Flags are
+// cached by refresh, so a country refreshed before the cache was enabled
+// has none until the next refresh.
+func (h *CountryHandler) GetCountryFlag(c *gin.Context) {
+	flag, err := h.flags.Flag(c.Param("name"))
+	if errors.Is(err, services.ErrFlagNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Flag not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// Flags come from a third party. Opened directly, an SVG would run its
+	// scripts on this API's origin, so it is sandboxed and never sniffed.
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "public, max-age=86400")
+	serveImage(c, flag.ContentType, flag.ETag, flag.ModTime, flag.Data)
 }
 
 func (h *CountryHandler) DeleteCountryByName(c *gin.Context) {
@@ -109,8 +360,8 @@ func (h *CountryHandler) DeleteCountryByName(c *gin.Context) {
 		return
 	}
 
-	err := h.repo.DeleteCountryByName(name)
-	if err == sql.ErrNoRows {
+	err := h.countryService.DeleteCountry(c.Request.Context(), name)
+	if errors.Is(err, sql.ErrNoRows) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "Country not found",
 		})
@@ -152,15 +403,387 @@ func (h *CountryHandler) GetStatus(c *gin.Context) {
 	})
 }
 
+// renderedImageMaxAge is how long clients may reuse an on-demand render. Renders
+// are keyed by data version, so a stale copy is at most this old.
+const renderedImageMaxAge = 5 * time.Minute
+
+// GetSummaryImage serves the summary image generated on refresh, or renders
+// one on demand when any query parameter is given or SVG or JPEG is asked for
 func (h *CountryHandler) GetSummaryImage(c *gin.Context) {
-	imagePath := h.imageService.GetImagePath()
+	c.Header("Vary", "Accept")
 
-	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
+	opts, custom, details := parseImageOptions(c, h.imageService.ThemeNames())
+	if len(details) > 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Validation failed",
+			Details: details,
+		})
+		return
+	}
+
+	if custom {
+		data, err := h.imageService.RenderImage(opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error:   "Internal server error",
+				Details: err.Error(),
+			})
+			return
+		}
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(renderedImageMaxAge.Seconds())))
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, imageFilename(opts)))
+		serveImage(c, services.ContentType(opts.Format), services.ImageETag(data), time.Time{}, data)
+		return
+	}
+
+	summary, err := h.imageService.SummaryImage()
+	if errors.Is(err, services.ErrImageNotFound) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Summary image not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	// The stored image is replaced on every refresh, so clients must revalidate
+	c.Header("Cache-Control", "no-cache")
+	serveImage(c, services.ContentType(models.ImageFormatPNG), summary.ETag, summary.ModTime, summary.Data)
+}
+
+// GetAnimatedImage serves a GIF bar-chart race with one frame per refresh
+func (h *CountryHandler) GetAnimatedImage(c *gin.Context) {
+	opts, details := parseAnimationOptions(c, h.imageService.ThemeNames())
+	if len(details) > 0 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:   "Validation failed",
+			Details: details,
+		})
+		return
+	}
+
+	data, err := h.imageService.RenderAnimation(opts)
+	if errors.Is(err, services.ErrNoSnapshots) {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "No refresh history in range",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(renderedImageMaxAge.Seconds())))
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="summary-%s-animated.gif"`, opts.Metric))
+	serveImage(c, "image/gif", services.ImageETag(data), time.Time{}, data)
+}
+
+// parseAnimationOptions reads the animated image query parameters on top of the defaults
+func parseAnimationOptions(c *gin.Context, themes []string) (opts services.AnimationOptions, details models.ValidationErrorDetails) {
+	opts = services.DefaultAnimationOptions
+	details = models.ValidationErrorDetails{}
+
+	if metric := c.Query("metric"); metric != "" {
+		switch metric {
+		case models.MetricGDP, models.MetricPopulation, models.MetricGDPPerCapita, models.MetricExchangeRate:
+			opts.Metric = metric
+		default:
+			details["metric"] = "must be one of gdp, population, gdp_per_capita, exchange_rate"
+		}
+	}
+
+	opts.Region = c.Query("region")
+
+	if theme := c.Query("theme"); theme != "" {
+		if slices.Contains(themes, theme) {
+			opts.Theme = theme
+		} else {
+			details["theme"] = "must be one of " + strings.Join(themes, ", ")
+		}
+	}
+
+	intParams := []struct {
+		name     string
+		min, max int
+		dest     *int
+	}{
+		{"top", 1, services.MaxImageTop, &opts.Top},
+		{"width", services.MinImageWidth, services.MaxImageWidth, &opts.Width},
+		{"height", services.MinImageHeight, services.MaxImageHeight, &opts.Height},
+		{"frames", 1, services.MaxAnimationFrames, &opts.Frames},
+	}
+	for _, p := range intParams {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < p.min || parsed > p.max {
+			details[p.name] = fmt.Sprintf("must be an integer between %d and %d", p.min, p.max)
+			continue
+		}
+		*p.dest = parsed
+	}
+
+	var err error
+	if opts.From, err = parseRangeEnd(c.Query("from"), false); err != nil {
+		details["from"] = err.Error()
+	}
+	if opts.To, err = parseRangeEnd(c.Query("to"), true); err != nil {
+		details["to"] = err.Error()
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.From.After(opts.To) {
+		details["to"] = "must not be before from"
+	}
+
+	return opts, details
+}
+
+// parseRangeEnd parses an RFC 3339 time or a date. A date given as the end of
+// a range covers that whole day.
+func parseRangeEnd(raw string, end bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+
+	day, err := time.Parse(time.DateOnly, raw)
+	if err != nil {
+		return time.Time{}, errors.New("must be a date (2006-01-02) or an RFC 3339 time")
+	}
+	if end {
+		return day.AddDate(0, 0, 1).Add(-time.Millisecond), nil
+	}
+	return day, nil
+}
+
+// GetImageHistory lists the summary images kept for past refresh runs
+func (h *CountryHandler) GetImageHistory(c *gin.Context) {
+	limit := defaultRunsLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxRunsLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"limit": "must be an integer between 1 and 100",
+				},
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	images, err := h.imageService.ImageHistory(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// GetRunImage serves the summary image generated by a refresh run. Its
+// content never changes, so clients may cache it indefinitely.
+func (h *CountryHandler) GetRunImage(c *gin.Context) {
+	runID, err := strconv.ParseInt(c.Param("run_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Validation failed",
+			Details: models.ValidationErrorDetails{
+				"run_id": "must be an integer",
+			},
+		})
+		return
+	}
+
+	img, err := h.imageService.RunImage(runID)
+	if errors.Is(err, services.ErrImageNotFound) {
 		c.JSON(http.StatusNotFound, models.ErrorResponse{
 			Error: "Summary image not found",
 		})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	serveImage(c, services.ContentType(models.ImageFormatPNG), img.ETag, img.ModTime, img.Data)
+}
+
+// serveImage writes data with its ETag, and Last-Modified unless modTime is
+// zero. Matching If-None-Match or If-Modified-Since get 304 Not Modified.
+func serveImage(c *gin.Context, contentType, etag string, modTime time.Time, data []byte) {
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", etag)
+	http.ServeContent(c.Writer, c.Request, "", modTime, bytes.NewReader(data))
+}
+
+// negotiateImageFormat picks the image format for an Accept header. Browsers
+// list SVG and other types before image/* in their <img> Accept headers, so
+// SVG or JPEG is only chosen when named with a strictly higher q-value than
+// PNG gets, directly or through image/* or */*. Anything else is PNG.
+func negotiateImageFormat(accept string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+
+		weight := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			weight = parsed
+		}
+
+		// A type listed twice keeps its best weight
+		if prev, ok := q[mediaType]; !ok || weight > prev {
+			q[mediaType] = weight
+		}
+	}
+
+	// The most specific range naming PNG decides its weight
+	pngQ := 0.0
+	for _, mediaType := range []string{"*/*", "image/*", "image/png"} {
+		if weight, ok := q[mediaType]; ok {
+			pngQ = weight
+		}
+	}
+
+	format, best := models.ImageFormatPNG, pngQ
+	for _, candidate := range []struct{ mediaType, format string }{
+		{"image/svg+xml", models.ImageFormatSVG},
+		{"image/jpeg", models.ImageFormatJPEG},
+	} {
+		if weight, ok := q[candidate.mediaType]; ok && weight > best {
+			format, best = candidate.format, weight
+		}
+	}
+	return format
+}
+
+// imageFilename names a render for saving, e.g. summary-gdp@2x.jpg
+func imageFilename(opts services.ImageOptions) string {
+	name := "summary-" + opts.Metric
+	if opts.Scale > 1 {
+		name += fmt.Sprintf("@%dx", opts.Scale)
+	}
+	ext := opts.Format
+	if ext == models.ImageFormatJPEG {
+		ext = "jpg"
+	}
+	return name + "." + ext
+}
+
+// parseImageOptions reads the summary image query parameters on top of the
+// defaults. custom reports whether any was given.
+func parseImageOptions(c *gin.Context, themes []string) (opts services.ImageOptions, custom bool, details models.ValidationErrorDetails) {
+	opts = services.DefaultImageOptions
+	details = models.ValidationErrorDetails{}
+
+	if metric := c.Query("metric"); metric != "" {
+		switch metric {
+		case models.MetricGDP, models.MetricPopulation, models.MetricGDPPerCapita, models.MetricExchangeRate:
+			opts.Metric = metric
+		default:
+			details["metric"] = "must be one of gdp, population, gdp_per_capita, exchange_rate"
+		}
+		custom = true
+	}
+
+	if region := c.Query("region"); region != "" {
+		opts.Region = region
+		custom = true
+	}
+
+	if theme := c.Query("theme"); theme != "" {
+		if slices.Contains(themes, theme) {
+			opts.Theme = theme
+		} else {
+			details["theme"] = "must be one of " + strings.Join(themes, ", ")
+		}
+		custom = true
+	}
+
+	// ?format= wins over the Accept header. Only the PNG is pre-generated.
+	switch format := strings.ToLower(c.Query("format")); format {
+	case "":
+		if format := negotiateImageFormat(c.GetHeader("Accept")); format != models.ImageFormatPNG {
+			opts.Format = format
+			custom = true
+		}
+	case models.ImageFormatPNG:
+	case models.ImageFormatSVG, models.ImageFormatJPEG:
+		opts.Format = format
+		custom = true
+	case "jpg":
+		opts.Format = models.ImageFormatJPEG
+		custom = true
+	default:
+		details["format"] = "must be one of png, svg, jpeg"
+	}
+
+	intParams := []struct {
+		name     string
+		min, max int
+		dest     *int
+	}{
+		{"top", 1, services.MaxImageTop, &opts.Top},
+		{"width", services.MinImageWidth, services.MaxImageWidth, &opts.Width},
+		{"height", services.MinImageHeight, services.MaxImageHeight, &opts.Height},
+		{"scale", 1, services.MaxImageScale, &opts.Scale},
+		{"quality", 1, 100, &opts.Quality},
+	}
+	for _, p := range intParams {
+		raw := c.Query(p.name)
+		if raw == "" {
+			continue
+		}
+		custom = true
+
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < p.min || parsed > p.max {
+			details[p.name] = fmt.Sprintf("must be an integer between %d and %d", p.min, p.max)
+			continue
+		}
+		*p.dest = parsed
+	}
+
+	if c.Query("quality") != "" && opts.Format != models.ImageFormatJPEG {
+		details["quality"] = "only applies to format=jpeg"
+	}
+	if opts.Format != models.ImageFormatSVG && opts.Width*opts.Height*opts.Scale*opts.Scale > services.MaxImagePixels {
+		details["scale"] = fmt.Sprintf("width × height × scale² must not exceed %d pixels", services.MaxImagePixels)
+	}
 
-	c.File(imagePath)
+	return opts, custom, details
 }
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"countryCurrency/internal/models"
+	"countryCurrency/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateImageFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"no header", "", models.ImageFormatPNG},
+		{"anything", "*/*", models.ImageFormatPNG},
+		{"chrome img", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", models.ImageFormatPNG},
+		{"firefox img", "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5", models.ImageFormatPNG},
+		{"svg refused", "image/svg+xml;q=0, image/png", models.ImageFormatPNG},
+		{"svg only", "image/svg+xml", models.ImageFormatSVG},
+		{"svg over wildcard", "image/svg+xml, */*;q=0.1", models.ImageFormatSVG},
+		{"svg tied with png", "image/svg+xml, image/png", models.ImageFormatPNG},
+		{"jpeg only", "image/jpeg", models.ImageFormatJPEG},
+		{"jpeg preferred", "image/png;q=0.5, image/jpeg;q=0.9", models.ImageFormatJPEG},
+		{"best of svg and jpeg", "image/jpeg;q=0.6, image/svg+xml;q=0.8, image/*;q=0.5", models.ImageFormatSVG},
+		{"case and spaces", " IMAGE/SVG+XML ; Q=1 , image/png ; q=0.2", models.ImageFormatSVG},
+		{"invalid q counts as zero", "image/svg+xml;q=high", models.ImageFormatPNG},
+		{"unrelated types", "text/html, application/json", models.ImageFormatPNG},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateImageFormat(tt.accept); got != tt.want {
+				t.Errorf("negotiateImageFormat(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImageOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	themes := []string{services.ThemeDark, services.ThemeLight}
+
+	tests := []struct {
+		name       string
+		query      string
+		accept     string
+		wantCustom bool
+		wantFormat string
+		wantErrors []string
+	}{
+		{name: "defaults", wantFormat: models.ImageFormatPNG},
+		{name: "browser gets the stored png", accept: "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", wantFormat: models.ImageFormatPNG},
+		{name: "accept svg", accept: "image/svg+xml", wantCustom: true, wantFormat: models.ImageFormatSVG},
+		{name: "format wins over accept", query: "format=png", accept: "image/svg+xml", wantFormat: models.ImageFormatPNG},
+		{name: "jpg alias", query: "format=JPG", wantCustom: true, wantFormat: models.ImageFormatJPEG},
+		{name: "unknown format", query: "format=bmp", wantFormat: models.ImageFormatPNG, wantErrors: []string{"format"}},
+		{name: "quality needs jpeg", query: "quality=80", wantCustom: true, wantFormat: models.ImageFormatPNG, wantErrors: []string{"quality"}},
+		{name: "jpeg quality", query: "format=jpeg&quality=80", wantCustom: true, wantFormat: models.ImageFormatJPEG},
+		{name: "unknown theme", query: "theme=neon", wantCustom: true, wantFormat: models.ImageFormatPNG, wantErrors: []string{"theme"}},
+		{name: "unknown metric", query: "metric=area", wantCustom: true, wantFormat: models.ImageFormatPNG, wantErrors: []string{"metric"}},
+		{name: "top out of range", query: "top=0", wantCustom: true, wantFormat: models.ImageFormatPNG, wantErrors: []string{"top"}},
+		{name: "scale not a number", query: "scale=two", wantCustom: true, wantFormat: models.ImageFormatPNG, wantErrors: []string{"scale"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/countries/image?"+tt.query, nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+
+			opts, custom, details := parseImageOptions(c, themes)
+			if custom != tt.wantCustom {
+				t.Errorf("custom = %v, want %v", custom, tt.wantCustom)
+			}
+			if opts.Format != tt.wantFormat {
+				t.Errorf("format = %q, want %q", opts.Format, tt.wantFormat)
+			}
+			if len(details) != len(tt.wantErrors) {
+				t.Errorf("details = %v, want errors for %q", details, tt.wantErrors)
+			}
+			for _, field := range tt.wantErrors {
+				if _, ok := details[field]; !ok {
+					t.Errorf("details = %v, want an error for %s", details, field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"countryCurrency/internal/models"
+	"countryCurrency/internal/services"
+)
+
+type CurrencyHandler struct {
+	currencies *services.CurrencyRegistry
+}
+
+func NewCurrencyHandler(currencies *services.CurrencyRegistry) *CurrencyHandler {
+	return &CurrencyHandler{
+		currencies: currencies,
+	}
+}
+
+// GetCurrencies lists the ISO 4217 table, active codes only unless ?include_withdrawn=true
+func (h *CurrencyHandler) GetCurrencies(c *gin.Context) {
+	includeWithdrawn := false
+	if raw := c.Query("include_withdrawn"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"include_withdrawn": "must be true or false",
+				},
+			})
+			return
+		}
+		includeWithdrawn = parsed
+	}
+
+	c.JSON(http.StatusOK, h.currencies.All(includeWithdrawn))
+}
+
+// GetCurrency returns one ISO 4217 entry; withdrawn codes name their current successor
+func (h *CurrencyHandler) GetCurrency(c *gin.Context) {
+	currency, ok := h.currencies.Lookup(c.Param("code"))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Currency not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, currency)
+}
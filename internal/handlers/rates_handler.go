@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+	"countryCurrency/internal/services"
+)
+
+type RatesHandler struct {
+	repo           *database.Repository
+	countryService *services.CountryService
+	refreshJobs    *services.RefreshJobs
+}
+
+func NewRatesHandler(repo *database.Repository, countryService *services.CountryService, refreshJobs *services.RefreshJobs) *RatesHandler {
+	return &RatesHandler{
+		repo:           repo,
+		countryService: countryService,
+		refreshJobs:    refreshJobs,
+	}
+}
+
+// GetQuarantine lists quarantined rates, pending ones unless ?status= says otherwise
+func (h *RatesHandler) GetQuarantine(c *gin.Context) {
+	status := c.DefaultQuery("status", models.QuarantinePending)
+	switch status {
+	case models.QuarantinePending, models.QuarantineApproved, models.QuarantineRejected:
+	case "all":
+		status = ""
+	default:
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Validation failed",
+			Details: models.ValidationErrorDetails{
+				"status": "must be one of pending, approved, rejected, all",
+			},
+		})
+		return
+	}
+
+	entries, err := h.repo.GetQuarantinedRates(status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// ApproveQuarantine applies a quarantined rate and recomputes the affected GDP estimates
+func (h *RatesHandler) ApproveQuarantine(c *gin.Context) {
+	h.resolve(c, h.countryService.ApproveQuarantinedRate)
+}
+
+// RejectQuarantine discards a quarantined rate
+func (h *RatesHandler) RejectQuarantine(c *gin.Context) {
+	h.resolve(c, h.countryService.RejectQuarantinedRate)
+}
+
+func (h *RatesHandler) resolve(c *gin.Context, action func(ctx context.Context, id int64) (*models.RateQuarantine, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Validation failed",
+			Details: models.ValidationErrorDetails{
+				"id": "must be an integer",
+			},
+		})
+		return
+	}
+
+	// Resolving writes stored rates, so it takes the refresh slot and lease
+	var entry *models.RateQuarantine
+	err = h.refreshJobs.Exclusive(c.Request.Context(), func() error {
+		var err error
+		entry, err = action(c.Request.Context(), id)
+		return err
+	})
+	switch {
+	case errors.Is(err, services.ErrRefreshBusy), errors.Is(err, services.ErrRefreshRunningElsewhere):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Refresh already in progress",
+			Details: err.Error(),
+		})
+		return
+	case errors.Is(err, services.ErrQuarantineNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Quarantined rate not found",
+		})
+		return
+	case errors.Is(err, services.ErrQuarantineResolved):
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error:   "Quarantined rate already resolved",
+			Details: err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+	"countryCurrency/internal/services"
+)
+
+const (
+	defaultRunsLimit = 20
+	maxRunsLimit     = 100
+)
+
+type RefreshHandler struct {
+	repo        *database.Repository
+	refreshJobs *services.RefreshJobs
+}
+
+func NewRefreshHandler(repo *database.Repository, refreshJobs *services.RefreshJobs) *RefreshHandler {
+	return &RefreshHandler{
+		repo:        repo,
+		refreshJobs: refreshJobs,
+	}
+}
+
+func (h *RefreshHandler) GetRefreshJob(c *gin.Context) {
+	job, ok := h.refreshJobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Refresh job not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *RefreshHandler) GetRefreshRuns(c *gin.Context) {
+	limit := defaultRunsLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxRunsLimit {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Validation failed",
+				Details: models.ValidationErrorDetails{
+					"limit": "must be an integer between 1 and 100",
+				},
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := h.repo.GetRefreshRuns(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+func (h *RefreshHandler) GetRefreshRun(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Validation failed",
+			Details: models.ValidationErrorDetails{
+				"id": "must be an integer",
+			},
+		})
+		return
+	}
+
+	run, err := h.repo.GetRefreshRun(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error:   "Internal server error",
+			Details: err.Error(),
+		})
+		return
+	}
+
+	if run == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Refresh run not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -3,16 +3,70 @@ package models
 import "time"
 
 type Country struct {
-	ID              int64     `json:"id" db:"id"`
-	Name            string    `json:"name" db:"name"`
-	Capital         *string   `json:"capital" db:"capital"`
-	Region          *string   `json:"region" db:"region"`
-	Population      int64     `json:"population" db:"population"`
-	CurrencyCode    *string   `json:"currency_code" db:"currency_code"`
-	ExchangeRate    *float64  `json:"exchange_rate" db:"exchange_rate"`
-	EstimatedGDP    *float64  `json:"estimated_gdp" db:"estimated_gdp"`
-	FlagURL         *string   `json:"flag_url" db:"flag_url"`
-	LastRefreshedAt time.Time `json:"last_refreshed_at" db:"last_refreshed_at"`
+	ID              int64      `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Capital         *string    `json:"capital" db:"capital"`
+	Region          *string    `json:"region" db:"region"`
+	Population      int64      `json:"population" db:"population"`
+	CurrencyCode    *string    `json:"currency_code" db:"currency_code"`
+	ExchangeRate    *float64   `json:"exchange_rate" db:"exchange_rate"`
+	EstimatedGDP    *float64   `json:"estimated_gdp" db:"estimated_gdp"`
+	FlagURL         *string    `json:"flag_url" db:"flag_url"`
+	LastRefreshedAt time.Time  `json:"last_refreshed_at" db:"last_refreshed_at"`
+	StaleSince      *time.Time `json:"stale_since,omitempty" db:"stale_since"`
+}
+
+// UpsertStats classifies the rows written by a bulk upsert
+type UpsertStats struct {
+	Inserted  int          `json:"inserted"`
+	Updated   int          `json:"updated"`
+	Unchanged int          `json:"unchanged"`
+	Failed    []RowFailure `json:"failed"`
+}
+
+// SameSourceData reports whether c and other hold the same upstream-derived values.
+// EstimatedGDP is left out because it is re-estimated on every refresh.
+func (c Country) SameSourceData(other Country) bool {
+	return len(c.Changes(other)) == 0
+}
+
+// FieldChange is the old and new value of one country field
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Changes lists the upstream-derived fields that differ between c and updated,
+// keyed by JSON field name. EstimatedGDP is re-estimated on every refresh, so it
+// is only listed next to other changes.
+func (c Country) Changes(updated Country) map[string]FieldChange {
+	changes := map[string]FieldChange{}
+	if c.Population != updated.Population {
+		changes["population"] = FieldChange{Old: c.Population, New: updated.Population}
+	}
+	diffPtr(changes, "capital", c.Capital, updated.Capital)
+	diffPtr(changes, "region", c.Region, updated.Region)
+	diffPtr(changes, "currency_code", c.CurrencyCode, updated.CurrencyCode)
+	diffPtr(changes, "exchange_rate", c.ExchangeRate, updated.ExchangeRate)
+	diffPtr(changes, "flag_url", c.FlagURL, updated.FlagURL)
+
+	if len(changes) > 0 && !equalPtr(c.EstimatedGDP, updated.EstimatedGDP) {
+		changes["estimated_gdp"] = FieldChange{Old: c.EstimatedGDP, New: updated.EstimatedGDP}
+	}
+	return changes
+}
+
+func diffPtr[T comparable](changes map[string]FieldChange, field string, old, updated *T) {
+	if !equalPtr(old, updated) {
+		changes[field] = FieldChange{Old: old, New: updated}
+	}
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 type CountryAPIResponse struct {
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// FlagAsset is a country's flag downloaded into the local flag cache. The
+// file is stored under its content hash; ETag and LastModified are the
+// upstream validators used to skip unchanged flags.
+type FlagAsset struct {
+	CountryName  string
+	SourceURL    string
+	Hash         string
+	ContentType  string
+	SizeBytes    int
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+	ChangedAt    time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Metrics a summary image can rank countries by
+const (
+	MetricGDP          = "gdp"
+	MetricPopulation   = "population"
+	MetricGDPPerCapita = "gdp_per_capita"
+	MetricExchangeRate = "exchange_rate"
+)
+
+// Summary image output formats
+const (
+	ImageFormatPNG  = "png"
+	ImageFormatSVG  = "svg"
+	ImageFormatJPEG = "jpeg"
+)
+
+// SummaryImage is a summary image kept in the history, linked to the
+// refresh run that generated it. Runs with identical data share one file.
+type SummaryImage struct {
+	ID        int64     `json:"id"`
+	RunID     int64     `json:"run_id"`
+	Hash      string    `json:"hash"`
+	Format    string    `json:"format"`
+	SizeBytes int       `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+}
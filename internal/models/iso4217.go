@@ -0,0 +1,14 @@
+package models
+
+// ISOCurrency is one entry of the ISO 4217 currency table
+type ISOCurrency struct {
+	Code       string `json:"code"`
+	Numeric    string `json:"numeric"`
+	MinorUnits int    `json:"minor_units"`
+	Name       string `json:"name"`
+	Withdrawn  bool   `json:"withdrawn"`
+	Successor  string `json:"successor,omitempty"`
+
+	// Current is where the successor chain of a withdrawn code ends
+	Current string `json:"current,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Quarantine statuses
+const (
+	QuarantinePending  = "pending"
+	QuarantineApproved = "approved"
+	QuarantineRejected = "rejected"
+)
+
+// RateQuarantine is a published exchange rate held back because it moved
+// too far from the stored rate. It is applied only once approved.
+type RateQuarantine struct {
+	ID           int64      `json:"id"`
+	CurrencyCode string     `json:"currency_code"`
+	OldRate      float64    `json:"old_rate"`
+	NewRate      float64    `json:"new_rate"`
+	ChangePct    float64    `json:"change_pct"`
+	Status       string     `json:"status"`
+	RunID        *int64     `json:"run_id"`
+	DetectedAt   time.Time  `json:"detected_at"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+}
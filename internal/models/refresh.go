@@ -0,0 +1,139 @@
+package models
+
+import "time"
+
+// Refresh triggers recorded on each run
+const (
+	TriggerAPI      = "api"
+	TriggerSchedule = "schedule"
+)
+
+// Refresh scopes: what a refresh fetches and writes
+const (
+	ScopeAll     = "all"
+	ScopeRates   = "rates"
+	ScopeCountry = "country"
+	ScopeRegion  = "region"
+)
+
+// Refresh run outcomes
+const (
+	OutcomeRunning   = "running"
+	OutcomeSucceeded = "succeeded"
+	OutcomeUnchanged = "unchanged"
+	OutcomeAborted   = "aborted"
+	OutcomeFailed    = "failed"
+)
+
+// SourceFetch records how fetching one upstream source went
+type SourceFetch struct {
+	Source     string    `json:"source"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Changed    bool      `json:"changed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// RowFailure is a country that could not be written during a refresh
+type RowFailure struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// Rejection is an upstream record that failed validation and was left out of
+// a refresh. Kept marks a record that was loaded anyway, with the offending
+// field cleared.
+type Rejection struct {
+	Source  string   `json:"source"`
+	Record  string   `json:"record"`
+	Reasons []string `json:"reasons"`
+	Kept    bool     `json:"kept,omitempty"`
+}
+
+// RefreshRun describes a single execution of the refresh workflow,
+// as stored in the refresh_runs table
+type RefreshRun struct {
+	ID           int64         `json:"id"`
+	Trigger      string        `json:"trigger"`
+	Scope        string        `json:"scope"`
+	Target       string        `json:"target,omitempty"`
+	StartedAt    time.Time     `json:"started_at"`
+	FinishedAt   *time.Time    `json:"finished_at"`
+	Outcome      string        `json:"outcome"`
+	Error        string        `json:"error,omitempty"`
+	RateProvider string        `json:"rate_provider"`
+	Sources      []SourceFetch `json:"sources"`
+	Inserted     int           `json:"inserted"`
+	Updated      int           `json:"updated"`
+	Unchanged    int           `json:"unchanged"`
+	Missing      int           `json:"missing"`
+	Failed       []RowFailure  `json:"failed"`
+	Quarantined  int           `json:"quarantined"`
+	Rejected     []Rejection   `json:"rejected"`
+}
+
+// Refresh job statuses
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Refresh progress stages
+const (
+	StageFetching        = "fetching"
+	StageUpserting       = "upserting"
+	StageCachingFlags    = "caching_flags"
+	StageGeneratingImage = "generating_image"
+	StageDone            = "done"
+)
+
+// RefreshProgress reports how far a refresh has come
+type RefreshProgress struct {
+	Stage          string `json:"stage"`
+	Fetched        int    `json:"fetched"`
+	Upserted       int    `json:"upserted"`
+	Total          int    `json:"total"`
+	ImageGenerated bool   `json:"image_generated"`
+}
+
+// RefreshJob is a refresh running in the background, polled through /refresh/jobs/:id
+type RefreshJob struct {
+	ID         string          `json:"id"`
+	Scope      string          `json:"scope"`
+	Target     string          `json:"target,omitempty"`
+	Status     string          `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+	Progress   RefreshProgress `json:"progress"`
+	Result     *RefreshRun     `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// CountryChange is a stored country that a refresh would modify
+type CountryChange struct {
+	Name   string                 `json:"name"`
+	Fields map[string]FieldChange `json:"fields"`
+}
+
+// RefreshDiff is what a refresh would change, computed by a dry run
+type RefreshDiff struct {
+	Scope     string          `json:"scope"`
+	Target    string          `json:"target,omitempty"`
+	Sources   []SourceFetch   `json:"sources"`
+	Added     []Country       `json:"added"`
+	Changed   []CountryChange `json:"changed"`
+	Unchanged int             `json:"unchanged"`
+
+	// Countries missing from the feed, by what the missing-country policy
+	// would do with them: keep them, mark them stale or soft-delete them
+	Kept        []Country `json:"kept"`
+	MarkedStale []Country `json:"marked_stale"`
+	Removed     []Country `json:"removed"`
+
+	// Quarantined lists the rates that would be held back instead of applied
+	Quarantined []RateQuarantine `json:"quarantined"`
+
+	// Rejected lists the upstream records validation would leave out
+	Rejected []Rejection `json:"rejected"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SnapshotRun is a refresh run whose resulting country data was captured in
+// country_snapshots
+type SnapshotRun struct {
+	RunID      int64     `json:"run_id"`
+	CapturedAt time.Time `json:"captured_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UpstreamValidator holds the cache validators of the last response from an
+// external API that was applied to the database. BodyHash is the sha256 of
+// that response, so a cached body that no longer matches is not reused.
+type UpstreamValidator struct {
+	Source       string
+	URL          string
+	ETag         string
+	LastModified string
+	BodyHash     string
+	UpdatedAt    time.Time
+}
@@ -3,8 +3,14 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"countryCurrency/internal/models"
@@ -14,64 +20,311 @@ type APIClient struct {
 	httpClient      *http.Client
 	countriesAPIURL string
 	exchangeAPIURL  string
+	cacheDir        string
+	validators      validatorStore
+
+	countriesTimeout time.Duration
+	ratesTimeout     time.Duration
 }
 
-func NewAPIClient(countriesURL, exchangeURL string) *APIClient {
+// FetchMode controls whether a fetch goes through the conditional request cache
+type FetchMode int
+
+const (
+	// FetchConditional sends stored validators, reuses the cached body on 304
+	// and stores new bodies
+	FetchConditional FetchMode = iota
+
+	// FetchUncached is a plain GET that neither reads nor updates the cache.
+	// Use it when the result will not be applied to every stored country, so
+	// the next conditional fetch still sees the change.
+	FetchUncached
+)
+
+// FetchResult describes how a fetch went
+type FetchResult struct {
+	// Changed is false when upstream answered 304 Not Modified and the cached
+	// body was used
+	Changed bool
+
+	// Validator, when set, describes a new response. Store it with
+	// Repository.SaveUpstreamValidator in the transaction that applies the
+	// response; until then conditional fetches download the response again.
+	Validator *models.UpstreamValidator
+}
+
+// validatorStore reads the validators of applied responses; the database
+// Repository implements it
+type validatorStore interface {
+	GetUpstreamValidator(source string) (*models.UpstreamValidator, error)
+}
+
+// NewAPIClient creates a client whose sources each get their own deadline,
+// applied per request through the context rather than on the http.Client.
+// Conditional fetches send the validators found in validators, and reuse the
+// last body kept under cacheDir.
+func NewAPIClient(validators validatorStore, countriesURL, exchangeURL, cacheDir string, countriesTimeout, ratesTimeout time.Duration) *APIClient {
 	return &APIClient{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		countriesAPIURL: countriesURL,
-		exchangeAPIURL:  exchangeURL,
+		httpClient:       &http.Client{},
+		countriesAPIURL:  countriesURL,
+		exchangeAPIURL:   exchangeURL,
+		cacheDir:         cacheDir,
+		validators:       validators,
+		countriesTimeout: countriesTimeout,
+		ratesTimeout:     ratesTimeout,
 	}
 }
 
-func (c *APIClient) FetchCountries(ctx context.Context) ([]models.CountryAPIResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.countriesAPIURL, nil)
+// RateProvider names the exchange rate source, for the refresh run record
+func (c *APIClient) RateProvider() string {
+	u, err := url.Parse(c.exchangeAPIURL)
+	if err != nil || u.Host == "" {
+		return c.exchangeAPIURL
+	}
+	return u.Host
+}
+
+// FetchCountries returns the countries payload and whether it changed since
+// the last applied fetch
+func (c *APIClient) FetchCountries(ctx context.Context, mode FetchMode) ([]models.CountryAPIResponse, FetchResult, error) {
+	ctx, cancel := withTimeout(ctx, c.countriesTimeout)
+	defer cancel()
+
+	var countries []models.CountryAPIResponse
+	result, err := c.fetch(ctx, "countries", c.countriesAPIURL, mode, func(body []byte) error {
+		if err := json.Unmarshal(body, &countries); err != nil {
+			return fmt.Errorf("failed to decode countries response: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, FetchResult{}, err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return countries, result, nil
+}
+
+// FetchExchangeRates returns the rates map and whether it changed since the
+// last applied fetch
+func (c *APIClient) FetchExchangeRates(ctx context.Context, mode FetchMode) (map[string]float64, FetchResult, error) {
+	ctx, cancel := withTimeout(ctx, c.ratesTimeout)
+	defer cancel()
+
+	var response models.ExchangeRateResponse
+	result, err := c.fetch(ctx, "exchange rates", c.exchangeAPIURL, mode, func(body []byte) error {
+		if err := json.Unmarshal(body, &response); err != nil {
+			return fmt.Errorf("failed to decode exchange rates response: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch countries: %w", err)
+		return nil, FetchResult{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("countries API returned status %d", resp.StatusCode)
+	// Return just the rates map
+	// Why? Handler only cares about rates, not other metadata
+	return response.Rates, result, nil
+}
+
+// FetchCountriesByName fetches the countries matching name, using the upstream
+// per-name endpoint when the configured URL has one
+func (c *APIClient) FetchCountriesByName(ctx context.Context, name string) ([]models.CountryAPIResponse, error) {
+	return c.fetchCountriesSubset(ctx, "name", name)
+}
+
+// FetchCountriesByRegion fetches the countries of region, using the upstream
+// per-region endpoint when the configured URL has one
+func (c *APIClient) FetchCountriesByRegion(ctx context.Context, region string) ([]models.CountryAPIResponse, error) {
+	return c.fetchCountriesSubset(ctx, "region", region)
+}
+
+// fetchCountriesSubset fetches /<kind>/<value> next to the configured /all
+// endpoint. Without such an endpoint it fetches everything, leaving the caller
+// to filter. A 404 from the subset endpoint means no country matched.
+func (c *APIClient) fetchCountriesSubset(ctx context.Context, kind, value string) ([]models.CountryAPIResponse, error) {
+	endpoint, ok := c.subsetEndpoint(kind, value)
+	if !ok {
+		countries, _, err := c.FetchCountries(ctx, FetchUncached)
+		return countries, err
 	}
 
+	ctx, cancel := withTimeout(ctx, c.countriesTimeout)
+	defer cancel()
+
 	var countries []models.CountryAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&countries); err != nil {
-		return nil, fmt.Errorf("failed to decode countries response: %w", err)
+	_, err := c.fetch(ctx, "countries", endpoint, FetchUncached, func(body []byte) error {
+		if err := json.Unmarshal(body, &countries); err != nil {
+			return fmt.Errorf("failed to decode countries response: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errNotFound) {
+		return []models.CountryAPIResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return countries, nil
 }
 
-func (c *APIClient) FetchExchangeRates(ctx context.Context) (map[string]float64, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.exchangeAPIURL, nil)
+// subsetEndpoint turns .../all?fields=... into .../<kind>/<value>?fields=...
+func (c *APIClient) subsetEndpoint(kind, value string) (string, bool) {
+	u, err := url.Parse(c.countriesAPIURL)
+	if err != nil || !strings.HasSuffix(u.Path, "/all") {
+		return "", false
+	}
+
+	base := strings.TrimSuffix(u.Path, "/all")
+	u.Path = base + "/" + kind + "/" + value
+	u.RawPath = base + "/" + kind + "/" + url.PathEscape(value)
+	return u.String(), true
+}
+
+// withTimeout bounds ctx by timeout, leaving it untouched when timeout is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// errNotFound is returned by fetch when the API answers 404
+var errNotFound = errors.New("not found")
+
+// fetch performs a GET for source. In FetchConditional mode it sends the
+// validators of the last applied response: on 304 Not Modified the cached body
+// is decoded instead. On 200 the body is cached once decode accepts it, and the
+// result carries its validators for the caller to store once it is applied.
+func (c *APIClient) fetch(ctx context.Context, source, endpoint string, mode FetchMode, decode func([]byte) error) (FetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return FetchResult{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	var cachedBody []byte
+	if mode == FetchConditional {
+		if v, body := c.loadCached(source, endpoint); body != nil {
+			cachedBody = body
+			if v.ETag != "" {
+				req.Header.Set("If-None-Match", v.ETag)
+			}
+			if v.LastModified != "" {
+				req.Header.Set("If-Modified-Since", v.LastModified)
+			}
+		}
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+		return FetchResult{}, fmt.Errorf("failed to fetch %s: %w", source, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cachedBody != nil {
+		return FetchResult{}, decode(cachedBody)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return FetchResult{}, fmt.Errorf("%s API returned status %d: %w", source, resp.StatusCode, errNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("exchange rate API returned status %d", resp.StatusCode)
+		return FetchResult{}, fmt.Errorf("%s API returned status %d", source, resp.StatusCode)
 	}
 
-	var result models.ExchangeRateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode exchange rates response: %w", err)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return FetchResult{}, fmt.Errorf("failed to read %s response: %w", source, err)
 	}
 
-	// Return just the rates map
-	// Why? Handler only cares about rates, not other metadata
-	return result.Rates, nil
+	if err := decode(body); err != nil {
+		return FetchResult{}, err
+	}
+
+	result := FetchResult{Changed: true}
+	if mode != FetchConditional {
+		return result, nil
+	}
+
+	validator := &models.UpstreamValidator{
+		Source:       source,
+		URL:          endpoint,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		BodyHash:     contentHash(body),
+		UpdatedAt:    time.Now(),
+	}
+	if c.cacheDir == "" || (validator.ETag == "" && validator.LastModified == "") {
+		return result, nil
+	}
+
+	// The body can be written now: until the validator is stored the
+	// previous one no longer matches it, so it is not reused
+	if err := c.storeBody(source, body); err != nil {
+		fmt.Printf("Warning: failed to cache %s response: %v\n", source, err)
+		return result, nil
+	}
+	result.Validator = validator
+
+	return result, nil
+}
+
+// loadCached returns the validators of the last applied response for source
+// and its cached body, but only when they were recorded for the same endpoint
+// and the body on disk is the one they describe
+func (c *APIClient) loadCached(source, endpoint string) (*models.UpstreamValidator, []byte) {
+	if c.cacheDir == "" || c.validators == nil {
+		return nil, nil
+	}
+
+	v, err := c.validators.GetUpstreamValidator(source)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return nil, nil
+	}
+	if v == nil || v.URL != endpoint || (v.ETag == "" && v.LastModified == "") {
+		return nil, nil
+	}
+
+	body, err := os.ReadFile(c.cachePath(source, ".body"))
+	if err != nil || contentHash(body) != v.BodyHash {
+		return nil, nil
+	}
+
+	return v, body
+}
+
+func (c *APIClient) storeBody(source string, body []byte) error {
+	if err := os.MkdirAll(c.cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return writeFileAtomic(c.cachePath(source, ".body"), body)
+}
+
+func (c *APIClient) cachePath(source, suffix string) string {
+	return filepath.Join(c.cacheDir, strings.ReplaceAll(source, " ", "_")+suffix)
+}
+
+// writeFileAtomic writes data to a temp file in the target directory and
+// renames it into place, so readers never observe a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"countryCurrency/internal/models"
+)
+
+const countriesBody = `[{"name":"Nigeria","population":206139589}]`
+
+// fakeValidators stands in for the upstream_validators table
+type fakeValidators map[string]*models.UpstreamValidator
+
+func (f fakeValidators) GetUpstreamValidator(source string) (*models.UpstreamValidator, error) {
+	return f[source], nil
+}
+
+// validatorServer answers If-None-Match "v1" with 304 and anything else with
+// countriesBody, recording the If-None-Match of each request
+type validatorServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	ifNoneMatch []string
+}
+
+func newValidatorServer(t *testing.T) *validatorServer {
+	s := &validatorServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+		s.mu.Unlock()
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(countriesBody))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *validatorServer) lastIfNoneMatch() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ifNoneMatch[len(s.ifNoneMatch)-1]
+}
+
+func (s *validatorServer) url() string {
+	return s.URL + "/all"
+}
+
+func TestFetchCountriesCachesNewResponse(t *testing.T) {
+	server := newValidatorServer(t)
+	dir := t.TempDir()
+	client := NewAPIClient(fakeValidators{}, server.url(), "", dir, 0, 0)
+
+	countries, result, err := client.FetchCountries(context.Background(), FetchConditional)
+	if err != nil {
+		t.Fatalf("FetchCountries: %v", err)
+	}
+	if len(countries) != 1 || countries[0].Name != "Nigeria" {
+		t.Fatalf("countries = %+v, want Nigeria", countries)
+	}
+	if server.lastIfNoneMatch() != "" {
+		t.Errorf("sent If-None-Match %q without stored validators", server.lastIfNoneMatch())
+	}
+	if !result.Changed {
+		t.Error("Changed = false, want true")
+	}
+
+	v := result.Validator
+	if v == nil {
+		t.Fatal("Validator = nil, want the validators of the response")
+	}
+	if v.Source != "countries" || v.URL != server.url() || v.ETag != `"v1"` || v.BodyHash != contentHash([]byte(countriesBody)) {
+		t.Errorf("Validator = %+v", v)
+	}
+
+	body, err := os.ReadFile(filepath.Join(dir, "countries.body"))
+	if err != nil {
+		t.Fatalf("cached body: %v", err)
+	}
+	if string(body) != countriesBody {
+		t.Errorf("cached body = %q, want %q", body, countriesBody)
+	}
+}
+
+func TestFetchCountriesNotModifiedUsesCachedBody(t *testing.T) {
+	server := newValidatorServer(t)
+	dir := t.TempDir()
+	validators := fakeValidators{}
+	client := NewAPIClient(validators, server.url(), "", dir, 0, 0)
+
+	_, first, err := client.FetchCountries(context.Background(), FetchConditional)
+	if err != nil {
+		t.Fatalf("first FetchCountries: %v", err)
+	}
+	// What the refresh transaction does once the response is applied
+	validators["countries"] = first.Validator
+
+	countries, result, err := client.FetchCountries(context.Background(), FetchConditional)
+	if err != nil {
+		t.Fatalf("second FetchCountries: %v", err)
+	}
+	if server.lastIfNoneMatch() != `"v1"` {
+		t.Errorf("If-None-Match = %q, want %q", server.lastIfNoneMatch(), `"v1"`)
+	}
+	if result.Changed || result.Validator != nil {
+		t.Errorf("result = %+v, want unchanged without validators", result)
+	}
+	if len(countries) != 1 || countries[0].Name != "Nigeria" {
+		t.Errorf("countries = %+v, want Nigeria from the cached body", countries)
+	}
+}
+
+// A response whose validators were never stored, e.g. because the refresh
+// rolled back, must be downloaded again rather than answered with 304
+func TestFetchCountriesRefetchesUnappliedResponse(t *testing.T) {
+	server := newValidatorServer(t)
+	client := NewAPIClient(fakeValidators{}, server.url(), "", t.TempDir(), 0, 0)
+
+	for i := 0; i < 2; i++ {
+		_, result, err := client.FetchCountries(context.Background(), FetchConditional)
+		if err != nil {
+			t.Fatalf("FetchCountries #%d: %v", i+1, err)
+		}
+		if !result.Changed {
+			t.Errorf("FetchCountries #%d: Changed = false, want true", i+1)
+		}
+		if server.lastIfNoneMatch() != "" {
+			t.Errorf("FetchCountries #%d: sent If-None-Match %q", i+1, server.lastIfNoneMatch())
+		}
+	}
+}
+
+func TestFetchCountriesIgnoresMismatchedValidator(t *testing.T) {
+	server := newValidatorServer(t)
+	hash := contentHash([]byte(countriesBody))
+
+	tests := []struct {
+		name      string
+		validator *models.UpstreamValidator
+		body      string
+	}{
+		{
+			name:      "other endpoint",
+			validator: &models.UpstreamValidator{Source: "countries", URL: "http://elsewhere/all", ETag: `"v1"`, BodyHash: hash},
+			body:      countriesBody,
+		},
+		{
+			name:      "body replaced since",
+			validator: &models.UpstreamValidator{Source: "countries", URL: server.url(), ETag: `"v1"`, BodyHash: hash},
+			body:      `[{"name":"Atlantis"}]`,
+		},
+		{
+			name:      "body missing",
+			validator: &models.UpstreamValidator{Source: "countries", URL: server.url(), ETag: `"v1"`, BodyHash: hash},
+		},
+		{
+			name:      "no validators",
+			validator: &models.UpstreamValidator{Source: "countries", URL: server.url(), BodyHash: hash},
+			body:      countriesBody,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.body != "" {
+				if err := os.WriteFile(filepath.Join(dir, "countries.body"), []byte(tt.body), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			client := NewAPIClient(fakeValidators{"countries": tt.validator}, server.url(), "", dir, 0, 0)
+
+			countries, result, err := client.FetchCountries(context.Background(), FetchConditional)
+			if err != nil {
+				t.Fatalf("FetchCountries: %v", err)
+			}
+			if server.lastIfNoneMatch() != "" {
+				t.Errorf("sent If-None-Match %q for a validator that does not match", server.lastIfNoneMatch())
+			}
+			if !result.Changed {
+				t.Error("Changed = false, want true")
+			}
+			if len(countries) != 1 || countries[0].Name != "Nigeria" {
+				t.Errorf("countries = %+v, want Nigeria from upstream", countries)
+			}
+		})
+	}
+}
+
+func TestFetchCountriesUncachedLeavesCacheAlone(t *testing.T) {
+	server := newValidatorServer(t)
+	dir := t.TempDir()
+	client := NewAPIClient(fakeValidators{}, server.url(), "", dir, 0, 0)
+
+	_, result, err := client.FetchCountries(context.Background(), FetchUncached)
+	if err != nil {
+		t.Fatalf("FetchCountries: %v", err)
+	}
+	if !result.Changed || result.Validator != nil {
+		t.Errorf("result = %+v, want changed without validators", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "countries.body")); !os.IsNotExist(err) {
+		t.Errorf("uncached fetch wrote a body: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// textAlign positions text relative to the x coordinate it is drawn at
+type textAlign int
+
+const (
+	alignLeft textAlign = iota
+	alignCenter
+	alignRight
+)
+
+// textStyle is how a piece of text is drawn
+type textStyle struct {
+	size  float64
+	bold  bool
+	color color.Color
+	align textAlign
+}
+
+// canvas is the drawing surface charts are drawn on, so the same chart code
+// produces every output format. Coordinates are in pixels from the top left;
+// text is positioned by its baseline.
+type canvas interface {
+	size() (width, height float64)
+	fill(col color.Color)
+	rect(x, y, w, h float64, col color.Color)
+	text(s string, x, y float64, style textStyle)
+
+	// image draws logo scaled into the given box
+	image(logo *chartLogo, x, y, w, h float64)
+
+	// measure returns the advance width of s
+	measure(s string, style textStyle) float64
+
+	// metrics returns how far text rises above and drops below its baseline
+	metrics(style textStyle) (ascent, descent float64)
+
+	encode(w io.Writer) error
+}
+
+// textMeasurer measures text with the loaded fonts. Vector output is measured
+// the same way, so layouts match the raster output. Faces are created at
+// scale times the requested size and results scaled back, so HiDPI output
+// is hinted for its real pixel size.
+type textMeasurer struct {
+	faces *faceCache
+	scale float64
+}
+
+func (m textMeasurer) face(style textStyle) font.Face {
+	return m.faces.face(style.size*m.scale, style.bold)
+}
+
+func (m textMeasurer) measure(s string, style textStyle) float64 {
+	return fromFixed(font.MeasureString(m.face(style), s)) / m.scale
+}
+
+func (m textMeasurer) metrics(style textStyle) (ascent, descent float64) {
+	metrics := m.face(style).Metrics()
+	return fromFixed(metrics.Ascent) / m.scale, fromFixed(metrics.Descent) / m.scale
+}
+
+// truncateText shortens s with an ellipsis so it fits in maxWidth
+func truncateText(c canvas, s string, style textStyle, maxWidth float64) string {
+	if c.measure(s, style) <= maxWidth {
+		return s
+	}
+
+	runes := []rune(s)
+	for n := len(runes) - 1; n > 0; n-- {
+		candidate := strings.TrimRight(string(runes[:n]), " ") + "…"
+		if c.measure(candidate, style) <= maxWidth {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// baselineFor returns the baseline that vertically centers text of style on center
+func baselineFor(c canvas, style textStyle, center float64) float64 {
+	ascent, descent := c.metrics(style)
+	return center + (ascent-descent)/2
+}
+
+// rasterCanvas draws into an RGBA image of scale times its logical size, and
+// encodes it as PNG, or as JPEG when jpegQuality is set
+type rasterCanvas struct {
+	textMeasurer
+	img         *image.RGBA
+	jpegQuality int
+}
+
+func newRasterCanvas(width, height int, scale float64, faces *faceCache) *rasterCanvas {
+	return &rasterCanvas{
+		textMeasurer: textMeasurer{faces: faces, scale: scale},
+		img:          image.NewRGBA(image.Rect(0, 0, round(float64(width)*scale), round(float64(height)*scale))),
+	}
+}
+
+func (c *rasterCanvas) size() (float64, float64) {
+	bounds := c.img.Bounds()
+	return float64(bounds.Dx()) / c.scale, float64(bounds.Dy()) / c.scale
+}
+
+func (c *rasterCanvas) fill(col color.Color) {
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+func (c *rasterCanvas) rect(x, y, w, h float64, col color.Color) {
+	r := image.Rect(round(x*c.scale), round(y*c.scale), round((x+w)*c.scale), round((y+h)*c.scale))
+	draw.Draw(c.img, r, image.NewUniform(col), image.Point{}, draw.Over)
+}
+
+func (c *rasterCanvas) image(logo *chartLogo, x, y, w, h float64) {
+	r := image.Rect(round(x*c.scale), round(y*c.scale), round((x+w)*c.scale), round((y+h)*c.scale))
+	draw.CatmullRom.Scale(c.img, r, logo.img, logo.img.Bounds(), draw.Over, nil)
+}
+
+func (c *rasterCanvas) text(s string, x, y float64, style textStyle) {
+	switch style.align {
+	case alignCenter:
+		x -= c.measure(s, style) / 2
+	case alignRight:
+		x -= c.measure(s, style)
+	}
+
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(style.color),
+		Face: c.face(style),
+		Dot:  fixed.Point26_6{X: toFixed(x * c.scale), Y: toFixed(y * c.scale)},
+	}
+	d.DrawString(s)
+}
+
+func (c *rasterCanvas) encode(w io.Writer) error {
+	if c.jpegQuality > 0 {
+		return jpeg.Encode(w, c.img, &jpeg.Options{Quality: c.jpegQuality})
+	}
+	return png.Encode(w, c.img)
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
+}
+
+func toFixed(v float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(v * 64))
+}
+
+func fromFixed(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
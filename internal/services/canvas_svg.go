@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+// svgCanvas writes an SVG document. Text stays real <text> elements, so the
+// image is searchable, selectable and readable by screen readers. scale only
+// enlarges the displayed size; the drawing is in logical units.
+type svgCanvas struct {
+	textMeasurer
+	width, height float64
+	displayScale  float64
+	title         string
+	family        string
+	body          bytes.Buffer
+}
+
+func newSVGCanvas(width, height int, scale float64, title string, faces *faceCache) *svgCanvas {
+	return &svgCanvas{
+		textMeasurer: textMeasurer{faces: faces, scale: 1},
+		width:        float64(width),
+		height:       float64(height),
+		displayScale: scale,
+		title:        title,
+		family:       faces.fonts.family,
+	}
+}
+
+func (c *svgCanvas) size() (float64, float64) {
+	return c.width, c.height
+}
+
+func (c *svgCanvas) fill(col color.Color) {
+	fmt.Fprintf(&c.body, `<rect width="100%%" height="100%%"%s/>`+"\n", svgFill(col))
+}
+
+func (c *svgCanvas) rect(x, y, w, h float64, col color.Color) {
+	fmt.Fprintf(&c.body, `<rect x="%s" y="%s" width="%s" height="%s"%s/>`+"\n",
+		svgNumber(x), svgNumber(y), svgNumber(w), svgNumber(h), svgFill(col))
+}
+
+func (c *svgCanvas) image(logo *chartLogo, x, y, w, h float64) {
+	fmt.Fprintf(&c.body, `<image x="%s" y="%s" width="%s" height="%s" href="data:image/png;base64,%s"/>`+"\n",
+		svgNumber(x), svgNumber(y), svgNumber(w), svgNumber(h), base64.StdEncoding.EncodeToString(logo.png))
+}
+
+func (c *svgCanvas) text(s string, x, y float64, style textStyle) {
+	anchor := "start"
+	switch style.align {
+	case alignCenter:
+		anchor = "middle"
+	case alignRight:
+		anchor = "end"
+	}
+
+	weight := ""
+	if style.bold {
+		weight = ` font-weight="bold"`
+	}
+
+	fmt.Fprintf(&c.body, `<text x="%s" y="%s" font-size="%s"%s text-anchor="%s"%s>`,
+		svgNumber(x), svgNumber(y), svgNumber(style.size), weight, anchor, svgFill(style.color))
+	xml.EscapeText(&c.body, []byte(s))
+	c.body.WriteString("</text>\n")
+}
+
+func (c *svgCanvas) encode(w io.Writer) error {
+	var doc bytes.Buffer
+
+	families := "'Helvetica Neue', Arial, sans-serif"
+	if c.family != "" {
+		families = "'" + c.family + "', " + families
+	}
+
+	fmt.Fprintf(&doc, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&doc, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %s %s" role="img" font-family="`,
+		svgNumber(c.width*c.displayScale), svgNumber(c.height*c.displayScale), svgNumber(c.width), svgNumber(c.height))
+	xml.EscapeText(&doc, []byte(families))
+	doc.WriteString("\">\n<title>")
+	xml.EscapeText(&doc, []byte(c.title))
+	doc.WriteString("</title>\n")
+	doc.Write(c.body.Bytes())
+	doc.WriteString("</svg>\n")
+
+	_, err := w.Write(doc.Bytes())
+	return err
+}
+
+// svgFill renders col as fill attributes, with an opacity only when needed
+func svgFill(col color.Color) string {
+	c := color.NRGBAModel.Convert(col).(color.NRGBA)
+	fill := fmt.Sprintf(` fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 255 {
+		fill += fmt.Sprintf(` fill-opacity="%s"`, svgNumber(float64(c.A)/255))
+	}
+	return fill
+}
+
+// svgNumber formats v with at most two decimals
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(float64(round(v*100))/100, 'f', -1, 64)
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// chartBar is one country in a bar chart
+type chartBar struct {
+	Label  string
+	Region string
+	Value  float64
+}
+
+// barChart describes a horizontal bar chart, independent of its pixel size
+type barChart struct {
+	Title    string
+	Subtitle string
+	Bars     []chartBar
+	Format   func(float64) string
+	Footer   string
+
+	// AxisMax keeps the value axis the same across charts, such as the frames
+	// of an animation; zero fits the axis to the bars
+	AxisMax float64
+}
+
+// chartUnit scales the 600x400 layout to the size of the image, so small
+// thumbnails and large renders keep the same proportions
+func chartUnit(width, height float64) float64 {
+	unit := math.Min(width/600, height/400)
+	return math.Max(0.5, math.Min(unit, 3))
+}
+
+// drawBarChart draws chart over the whole canvas in the colors and margins of theme
+func drawBarChart(c canvas, chart barChart, theme *chartTheme) error {
+	width, height := c.size()
+	unit := chartUnit(width, height)
+
+	// Many bars on a short image need a smaller label font
+	labelSize := 13 * unit
+	if len(chart.Bars) > 0 {
+		labelSize = math.Min(labelSize, height/float64(len(chart.Bars))*0.45)
+	}
+
+	titleStyle := textStyle{size: 20 * unit, bold: true, color: theme.text}
+	labelStyle := textStyle{size: math.Max(labelSize, 6), color: theme.text, align: alignRight}
+	valueStyle := textStyle{size: 11 * unit, color: theme.text}
+	mutedStyle := textStyle{size: 11 * unit, color: theme.mutedText}
+	lineHeight := func(style textStyle) float64 {
+		ascent, descent := c.metrics(style)
+		return ascent + descent + 2*unit
+	}
+
+	left, right := theme.margins.Left*unit, width-theme.margins.Right*unit
+	top := theme.margins.Top * unit
+
+	c.fill(theme.background)
+
+	// The logo is as tall as the title line, and the title makes room for it
+	titleAscent, titleDescent := c.metrics(titleStyle)
+	titleWidth := right - left
+	if theme.logo != nil {
+		bounds := theme.logo.img.Bounds()
+		logoHeight := titleAscent + titleDescent
+		logoWidth := math.Min(logoHeight*float64(bounds.Dx())/float64(bounds.Dy()), (right-left)*0.3)
+		logoHeight = logoWidth * float64(bounds.Dy()) / float64(bounds.Dx())
+		c.image(theme.logo, right-logoWidth, top, logoWidth, logoHeight)
+		titleWidth -= logoWidth + 10*unit
+	}
+
+	y := top + titleAscent
+	c.text(truncateText(c, chart.Title, titleStyle, titleWidth), left, y, titleStyle)
+	y += lineHeight(titleStyle)
+	if chart.Subtitle != "" {
+		c.text(truncateText(c, chart.Subtitle, mutedStyle, right-left), left, y, mutedStyle)
+	}
+	plotTop := y + 16*unit
+
+	footerY := height - theme.margins.Bottom*unit
+	if chart.Footer != "" {
+		c.text(truncateText(c, chart.Footer, mutedStyle, right-left), left, footerY, mutedStyle)
+	}
+
+	if len(chart.Bars) == 0 {
+		noData := mutedStyle
+		noData.align = alignCenter
+		c.text("No data", (left+right)/2, (plotTop+footerY)/2, noData)
+		return nil
+	}
+
+	legendY := footerY - 22*unit
+	drawLegend(c, chart.Bars, left, legendY, right-left, mutedStyle, unit, theme)
+
+	mutedAscent, _ := c.metrics(mutedStyle)
+	tickLabelY := legendY - 24*unit
+	plotBottom := tickLabelY - mutedAscent - 6*unit
+
+	maxValue := chart.AxisMax
+	labelWidth, valueWidth := 0.0, 0.0
+	for _, bar := range chart.Bars {
+		maxValue = math.Max(maxValue, bar.Value)
+		labelWidth = math.Max(labelWidth, c.measure(bar.Label, labelStyle))
+		valueWidth = math.Max(valueWidth, c.measure(chart.Format(bar.Value), valueStyle))
+	}
+	labelWidth = math.Min(labelWidth, width*0.35)
+
+	plotLeft := left + labelWidth + 10*unit
+	plotRight := right - valueWidth - 8*unit
+	if plotRight-plotLeft < 40*unit || plotBottom-plotTop < float64(len(chart.Bars)) {
+		return fmt.Errorf("image too small for %d bars", len(chart.Bars))
+	}
+
+	ticks := max(2, min(8, int((plotRight-plotLeft)/(80*unit))))
+	step, axisMax := niceScale(maxValue, ticks)
+	scale := (plotRight - plotLeft) / axisMax
+	line := math.Max(unit, 1)
+
+	// Gridlines and tick labels
+	tickStyle := mutedStyle
+	tickStyle.align = alignCenter
+	for tick := 0.0; tick <= axisMax*1.0000001; tick += step {
+		x := plotLeft + tick*scale
+		c.rect(x, plotTop, line, plotBottom-plotTop, theme.gridline)
+		c.text(chart.Format(tick), x, tickLabelY, tickStyle)
+	}
+	c.rect(plotLeft, plotTop, line, plotBottom-plotTop, theme.axis)
+	c.rect(plotLeft, plotBottom, plotRight-plotLeft, line, theme.axis)
+
+	slot := (plotBottom - plotTop) / float64(len(chart.Bars))
+	thickness := math.Max(slot*0.65, 1)
+	for i, bar := range chart.Bars {
+		center := plotTop + slot*float64(i) + slot/2
+		barWidth := bar.Value * scale
+		c.rect(plotLeft+line, center-thickness/2, barWidth, thickness, theme.regionColor(bar.Region))
+
+		label := truncateText(c, bar.Label, labelStyle, labelWidth)
+		c.text(label, plotLeft-10*unit, baselineFor(c, labelStyle, center), labelStyle)
+		c.text(chart.Format(bar.Value), plotLeft+line+barWidth+6*unit, baselineFor(c, valueStyle, center), valueStyle)
+	}
+
+	return nil
+}
+
+// drawLegend draws a color swatch and name for each region among bars
+func drawLegend(c canvas, bars []chartBar, x, y, maxWidth float64, style textStyle, unit float64, theme *chartTheme) {
+	swatch := 10 * unit
+	gap := 4 * unit
+	ascent, _ := c.metrics(style)
+
+	seen := map[string]bool{}
+	right := x + maxWidth
+	for _, bar := range bars {
+		region := bar.Region
+		if region == "" {
+			region = "Other"
+		}
+		if seen[region] {
+			continue
+		}
+		seen[region] = true
+
+		entryWidth := swatch + gap + c.measure(region, style) + 4*gap
+		if x+entryWidth > right {
+			return
+		}
+
+		c.rect(x, y-ascent, swatch, swatch, theme.regionColor(bar.Region))
+		c.text(region, x+swatch+gap, y, style)
+		x += entryWidth
+	}
+}
+
+// niceScale picks a round tick step (1, 2 or 5 times a power of ten) giving
+// about ticks intervals up to maxValue, and the axis maximum it implies
+func niceScale(maxValue float64, ticks int) (step, top float64) {
+	if maxValue <= 0 {
+		return 1, 1
+	}
+
+	raw := maxValue / float64(ticks)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	switch normalized := raw / magnitude; {
+	case normalized <= 1:
+		step = magnitude
+	case normalized <= 2:
+		step = 2 * magnitude
+	case normalized <= 5:
+		step = 5 * magnitude
+	default:
+		step = 10 * magnitude
+	}
+
+	return step, math.Ceil(maxValue/step) * step
+}
+
+// formatCompact formats v with a K/M/B/T suffix and at most one decimal,
+// such as 1.2T or 850B
+func formatCompact(v float64) string {
+	suffixes := []struct {
+		scale  float64
+		suffix string
+	}{
+		{1e12, "T"},
+		{1e9, "B"},
+		{1e6, "M"},
+		{1e3, "K"},
+	}
+
+	for _, s := range suffixes {
+		if math.Abs(v) >= s.scale {
+			return trimDecimal(v/s.scale) + s.suffix
+		}
+	}
+	return trimDecimal(v)
+}
+
+// formatMoney formats a US dollar amount such as $1.2T
+func formatMoney(v float64) string {
+	return "$" + formatCompact(v)
+}
+
+func trimDecimal(v float64) string {
+	switch abs := math.Abs(v); {
+	case abs >= 100:
+		return fmt.Sprintf("%.0f", v)
+	case abs >= 1 || abs == 0:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", v), ".0")
+	default:
+		// Rates of strong currencies such as 0.38 need two decimals
+		return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+	}
+}
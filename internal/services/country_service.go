@@ -2,60 +2,543 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
 	"countryCurrency/internal/database"
 	"countryCurrency/internal/models"
 )
 
+// ErrNoMatchingCountries reports that a partial refresh found no upstream country for its target
+var ErrNoMatchingCountries = errors.New("no matching countries upstream")
+
+// ErrRefreshAborted reports that a refresh was rolled back without publishing any data
+var ErrRefreshAborted = errors.New("refresh aborted")
+
+// MissingPolicy decides what a successful refresh does with stored countries
+// that the upstream feed no longer returns
+type MissingPolicy string
+
+const (
+	MissingKeep   MissingPolicy = "keep"
+	MissingStale  MissingPolicy = "stale"
+	MissingDelete MissingPolicy = "delete"
+)
+
+// RefreshSettings tunes how RefreshCountries loads upstream data
+type RefreshSettings struct {
+	// MaxFailedRows is how many countries may fail to load before the
+	// whole refresh is rolled back
+	MaxFailedRows int
+
+	// BatchSize is how many countries go into one multi-row upsert statement
+	BatchSize int
+
+	// MissingPolicy applies to countries absent from the upstream feed
+	MissingPolicy MissingPolicy
+
+	// RateAnomalyPct is the largest change, in percent of the stored rate, that
+	// a published rate may make before it is quarantined. Zero disables the check.
+	RateAnomalyPct float64
+
+	// MaxInvalidPct is the largest share, in percent, of invalid records either
+	// upstream source may contain before the refresh is aborted
+	MaxInvalidPct float64
+
+	// SnapshotRetention is how long country snapshots are kept for the
+	// animated summary image. Zero keeps them forever.
+	SnapshotRetention time.Duration
+}
+
 type CountryService struct {
 	repo       *database.Repository
 	apiClient  *APIClient
 	imgService *ImageService
+	flags      *FlagCache
+	currencies *CurrencyRegistry
+	settings   RefreshSettings
 }
 
-func NewCountryService(repo *database.Repository, apiClient *APIClient, imgService *ImageService) *CountryService {
+func NewCountryService(repo *database.Repository, apiClient *APIClient, imgService *ImageService, flags *FlagCache, currencies *CurrencyRegistry, settings RefreshSettings) *CountryService {
 	return &CountryService{
 		repo:       repo,
 		apiClient:  apiClient,
 		imgService: imgService,
+		flags:      flags,
+		currencies: currencies,
+		settings:   settings,
 	}
 }
 
-func (s *CountryService) RefreshCountries(ctx context.Context) error {
-	countriesData, err := s.apiClient.FetchCountries(ctx)
-	if err != nil {
-		return fmt.Errorf("could not fetch data from countries API: %w", err)
+// upstreamData is what a refresh fetched from the external APIs
+type upstreamData struct {
+	countries        []models.CountryAPIResponse
+	countriesChanged bool
+	rates            map[string]float64
+	ratesChanged     bool
+
+	// validators describe new conditional responses; they are stored in the
+	// transaction that applies them, see FetchResult
+	countriesValidator *models.UpstreamValidator
+	ratesValidator     *models.UpstreamValidator
+
+	// rejected names the country records validation dropped
+	rejected []string
+}
+
+// seenNames lists every country the feed returned, including rejected records,
+// so a bad record is not mistaken for a country that disappeared
+func (d *upstreamData) seenNames() []string {
+	names := make([]string, 0, len(d.countries)+len(d.rejected))
+	for _, apiCountry := range d.countries {
+		names = append(names, apiCountry.Name)
 	}
+	return append(names, d.rejected...)
+}
+
+// RefreshOptions describes a single refresh request
+type RefreshOptions struct {
+	// Trigger records what started the refresh, e.g. models.TriggerAPI
+	Trigger string
+
+	// Scope is models.ScopeAll (the default), models.ScopeRates,
+	// models.ScopeCountry or models.ScopeRegion
+	Scope string
 
-	exchangeRates, err := s.apiClient.FetchExchangeRates(ctx)
+	// Target is the country name or region of a partial refresh
+	Target string
+
+	// DryRun marks a refresh that must not write anything, see CountryService.DryRun
+	DryRun bool
+
+	// Progress, when set, is called as the refresh moves through its stages
+	Progress func(models.RefreshProgress)
+}
+
+// covers reports whether a refresh run with o also does everything other asks for,
+// so a caller asking for other can share it
+func (o RefreshOptions) covers(other RefreshOptions) bool {
+	if o.Scope == models.ScopeAll {
+		return true
+	}
+	return o.Scope == other.Scope && strings.EqualFold(o.Target, other.Target)
+}
+
+// partial reports whether the refresh only touches a single country or region
+func (o RefreshOptions) partial() bool {
+	return o.Scope == models.ScopeCountry || o.Scope == models.ScopeRegion
+}
+
+// fetchMode is conditional only for refreshes that apply what they fetch to
+// every country; partial refreshes and dry runs leave the cache alone
+func (o RefreshOptions) fetchMode() FetchMode {
+	if o.partial() || o.DryRun {
+		return FetchUncached
+	}
+	return FetchConditional
+}
+
+// report forwards p to the Progress callback, if any
+func (o RefreshOptions) report(p models.RefreshProgress) {
+	if o.Progress != nil {
+		o.Progress(p)
+	}
+}
+
+func (s *CountryService) RefreshCountries(ctx context.Context, opts RefreshOptions) (run *models.RefreshRun, err error) {
+	if opts.Scope == "" {
+		opts.Scope = models.ScopeAll
+	}
+
+	run = s.startRun(opts)
+	defer func() { s.finishRun(run, err) }()
+
+	opts.report(models.RefreshProgress{Stage: models.StageFetching})
+	if opts.Scope == models.ScopeRates {
+		return run, s.refreshRates(ctx, opts, run)
+	}
+
+	data, err := s.fetchUpstream(ctx, opts, run)
 	if err != nil {
-		return fmt.Errorf("could not fetch data from exchange rate API: %w", err)
+		return run, err
+	}
+
+	if opts.partial() {
+		data.countries = matchTarget(data.countries, opts)
+		if len(data.countries) == 0 {
+			return run, fmt.Errorf("%w: %s %q", ErrNoMatchingCountries, opts.Scope, opts.Target)
+		}
+	}
+
+	if err := s.validateUpstream(data, run); err != nil {
+		return run, err
+	}
+
+	progress := models.RefreshProgress{
+		Stage:   models.StageUpserting,
+		Fetched: len(data.countries),
+		Total:   len(data.countries),
+	}
+	opts.report(progress)
+
+	// Both sources answered 304, so the stored rows already reflect them
+	if !data.countriesChanged && !data.ratesChanged {
+		fmt.Println("Upstream data unchanged, skipping country upsert")
+		if err := s.repo.UpdateLastRefreshedAt(); err != nil {
+			return run, fmt.Errorf("failed to update refresh timestamp: %w", err)
+		}
+		run.Outcome = models.OutcomeUnchanged
+	} else if err := s.loadCountries(ctx, opts, data, run, func(done int) {
+		progress.Upserted = done
+		opts.report(progress)
+	}); err != nil {
+		return run, err
+	}
+
+	if run.Outcome != models.OutcomeUnchanged {
+		s.recordSnapshot(run)
+	}
+	s.cacheFlags(ctx, opts, data, run.Outcome == models.OutcomeUnchanged, progress)
+	s.finishImage(opts, run, progress)
+
+	return run, nil
+}
+
+// cacheFlags downloads the flags of the refreshed countries into the local
+// flag cache. When upstream was unchanged only flags not yet cached are
+// fetched. Failures are logged but do not fail the refresh.
+func (s *CountryService) cacheFlags(ctx context.Context, opts RefreshOptions, data *upstreamData, unchanged bool, progress models.RefreshProgress) {
+	progress.Stage = models.StageCachingFlags
+	opts.report(progress)
+
+	stats := s.flags.Sync(ctx, data.countries, unchanged)
+	if stats.Failed > 0 {
+		fmt.Printf("Warning: %d of %d flags could not be cached\n", stats.Failed, stats.Downloaded+stats.Unchanged+stats.Failed)
+	}
+}
+
+// recordSnapshot captures the countries as run left them, for the animated
+// summary image, and prunes snapshots past the retention period. Failures
+// are logged but do not fail the refresh.
+func (s *CountryService) recordSnapshot(run *models.RefreshRun) {
+	if run.ID == 0 {
+		return
 	}
 
 	now := time.Now()
-	for _, apiCountry := range countriesData {
-		country := s.transformCountry(apiCountry, exchangeRates, now)
+	if err := s.repo.SaveCountrySnapshot(run.ID, now); err != nil {
+		fmt.Printf("Warning: failed to snapshot countries for run %d: %v\n", run.ID, err)
+		return
+	}
+
+	if s.settings.SnapshotRetention > 0 {
+		if _, err := s.repo.PruneCountrySnapshots(now.Add(-s.settings.SnapshotRetention)); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+}
+
+// finishImage regenerates the summary image, keeping it in the history of
+// run, and reports the last progress stages
+func (s *CountryService) finishImage(opts RefreshOptions, run *models.RefreshRun, progress models.RefreshProgress) {
+	progress.Stage = models.StageGeneratingImage
+	opts.report(progress)
+	if err := s.imgService.GenerateSummaryImage(run.ID); err != nil {
+		fmt.Printf("Warning: failed to generate summary image: %v\n", err)
+	} else {
+		progress.ImageGenerated = true
+	}
+
+	progress.Stage = models.StageDone
+	opts.report(progress)
+}
+
+// startRun records a new run in refresh_runs. Failing to record it is
+// logged but does not stop the refresh.
+func (s *CountryService) startRun(opts RefreshOptions) *models.RefreshRun {
+	trigger := opts.Trigger
+	if trigger == "" {
+		trigger = models.TriggerAPI
+	}
+
+	run := &models.RefreshRun{
+		Trigger:      trigger,
+		Scope:        opts.Scope,
+		Target:       opts.Target,
+		StartedAt:    time.Now(),
+		Outcome:      models.OutcomeRunning,
+		RateProvider: s.apiClient.RateProvider(),
+		Sources:      []models.SourceFetch{},
+		Failed:       []models.RowFailure{},
+		Rejected:     []models.Rejection{},
+	}
+
+	if err := s.repo.CreateRefreshRun(run); err != nil {
+		fmt.Printf("Warning: failed to record refresh run: %v\n", err)
+	}
+
+	return run
+}
+
+// finishRun stamps the outcome of run and stores it
+func (s *CountryService) finishRun(run *models.RefreshRun, err error) {
+	finished := time.Now()
+	run.FinishedAt = &finished
+
+	switch {
+	case errors.Is(err, ErrRefreshAborted):
+		run.Outcome = models.OutcomeAborted
+		run.Error = err.Error()
+	case err != nil:
+		run.Outcome = models.OutcomeFailed
+		run.Error = err.Error()
+	case run.Outcome == models.OutcomeRunning:
+		run.Outcome = models.OutcomeSucceeded
+	}
+
+	if run.ID == 0 {
+		return
+	}
+	if err := s.repo.FinishRefreshRun(run); err != nil {
+		fmt.Printf("Warning: failed to record refresh run %d: %v\n", run.ID, err)
+	}
+}
+
+// loadCountries writes all fetched countries and the refresh timestamp in one
+// transaction, so readers see either the previous data set or the new one.
+// More than MaxFailedRows failed rows roll the whole load back.
+// Partial refreshes leave missing countries and the refresh timestamp alone.
+// onBatch is called with the number of countries written so far.
+func (s *CountryService) loadCountries(ctx context.Context, opts RefreshOptions, data *upstreamData, run *models.RefreshRun, onBatch func(done int)) error {
+	batchSize := s.settings.BatchSize
+	if batchSize <= 0 {
+		batchSize = max(len(data.countries), 1)
+	}
 
-		if err := s.repo.UpsertCountry(&country); err != nil {
-			fmt.Printf("Warning: failed to upsert country %s: %v\n", country.Name, err)
+	// Flags of soft-deleted countries; their files go once the rows are gone
+	var removedFlags []models.FlagAsset
+	err := s.repo.WithTx(ctx, func(tx *database.Repository) error {
+		removedFlags = nil
+
+		rates, err := s.quarantineRates(tx, data.rates, run)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		countries := make([]models.Country, 0, len(data.countries))
+		for _, apiCountry := range data.countries {
+			countries = append(countries, s.transformCountry(apiCountry, rates, now))
+		}
+
+		stats := models.UpsertStats{Failed: []models.RowFailure{}}
+		for start := 0; start < len(countries); start += batchSize {
+			batch := countries[start:min(start+batchSize, len(countries))]
+
+			batchStats, err := tx.BulkUpsertCountries(batch, batchSize)
+			stats.Failed = append(stats.Failed, batchStats.Failed...)
+			run.Failed = stats.Failed
+			if err != nil {
+				return err
+			}
+			if len(stats.Failed) > s.settings.MaxFailedRows {
+				return fmt.Errorf("%w after %d failed rows (threshold %d): %s",
+					ErrRefreshAborted, len(stats.Failed), s.settings.MaxFailedRows, stats.Failed[0].Error)
+			}
+
+			stats.Inserted += batchStats.Inserted
+			stats.Updated += batchStats.Updated
+			stats.Unchanged += batchStats.Unchanged
+			onBatch(start + len(batch))
+		}
+
+		if opts.Scope == models.ScopeAll {
+			missing, flags, err := s.applyMissingPolicy(tx, data.seenNames(), now)
+			removedFlags = flags
+			if err != nil {
+				return err
+			}
+
+			if err := tx.UpdateLastRefreshedAt(); err != nil {
+				return fmt.Errorf("failed to update refresh timestamp: %w", err)
+			}
+			run.Missing = int(missing)
+		}
+
+		// Rows that failed must be retried, so their source is fetched again
+		if len(stats.Failed) == 0 {
+			if err := saveValidators(tx, data.countriesValidator, data.ratesValidator); err != nil {
+				return err
+			}
+		}
+
+		run.Inserted, run.Updated, run.Unchanged = stats.Inserted, stats.Updated, stats.Unchanged
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.flags.Remove(removedFlags)
+	return nil
+}
+
+// saveValidators stores the validators of the responses a transaction applies,
+// so later conditional fetches of the same data get 304 Not Modified
+func saveValidators(tx *database.Repository, validators ...*models.UpstreamValidator) error {
+	for _, v := range validators {
+		if v == nil {
 			continue
 		}
+		if err := tx.SaveUpstreamValidator(v); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if err := s.repo.UpdateLastRefreshedAt(); err != nil {
-		return fmt.Errorf("failed to update refresh timestamp: %w", err)
+// applyMissingPolicy flags or soft-deletes stored countries whose names are not in seen.
+// Soft-deleted countries lose their cached flags, which are returned so their
+// files can be removed after commit.
+// An empty feed is never treated as every country having disappeared.
+func (s *CountryService) applyMissingPolicy(tx *database.Repository, seen []string, at time.Time) (int64, []models.FlagAsset, error) {
+	if len(seen) == 0 {
+		return 0, nil, nil
 	}
 
-	if err := s.imgService.GenerateSummaryImage(); err != nil {
-		fmt.Printf("Warning: failed to generate summary image: %v\n", err)
+	switch s.settings.MissingPolicy {
+	case MissingStale:
+		count, err := tx.MarkCountriesStale(seen, at)
+		return count, nil, err
+	case MissingDelete:
+		count, err := tx.SoftDeleteCountries(seen, at)
+		if err != nil {
+			return 0, nil, err
+		}
+		flags, err := tx.DeleteFlagAssetsExcept(seen)
+		return count, flags, err
+	default:
+		return 0, nil, nil
+	}
+}
+
+// DeleteCountry deletes the named country together with its cached flag.
+// It returns sql.ErrNoRows when there is no such country.
+func (s *CountryService) DeleteCountry(ctx context.Context, name string) error {
+	var flag *models.FlagAsset
+	err := s.repo.WithTx(ctx, func(tx *database.Repository) error {
+		if err := tx.DeleteCountryByName(name); err != nil {
+			return err
+		}
+		var err error
+		flag, err = tx.DeleteFlagAsset(name)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
+	if flag != nil {
+		s.flags.Remove([]models.FlagAsset{*flag})
+	}
 	return nil
 }
 
+// fetchUpstream fetches countries and exchange rates in parallel, each under
+// its own deadline, and records the timing of both sources on run.
+// When both fail, both errors are returned.
+// Partial refreshes bypass the conditional request cache, because they apply
+// what they fetch to only some countries.
+func (s *CountryService) fetchUpstream(ctx context.Context, opts RefreshOptions, run *models.RefreshRun) (*upstreamData, error) {
+	var (
+		data                       upstreamData
+		countriesErr, ratesErr     error
+		countriesFetch, ratesFetch models.SourceFetch
+		wg                         sync.WaitGroup
+	)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		countriesFetch, countriesErr = timeFetch("countries", func() (bool, error) {
+			countries, result, err := s.fetchCountries(ctx, opts)
+			data.countries, data.countriesChanged, data.countriesValidator = countries, result.Changed, result.Validator
+			return result.Changed, err
+		})
+		if countriesErr != nil {
+			countriesErr = fmt.Errorf("could not fetch data from countries API: %w", countriesErr)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		ratesFetch, ratesErr = timeFetch("exchange_rates", func() (bool, error) {
+			rates, result, err := s.apiClient.FetchExchangeRates(ctx, opts.fetchMode())
+			data.rates, data.ratesChanged, data.ratesValidator = rates, result.Changed, result.Validator
+			return result.Changed, err
+		})
+		if ratesErr != nil {
+			ratesErr = fmt.Errorf("could not fetch data from exchange rate API: %w", ratesErr)
+		}
+	}()
+	wg.Wait()
+
+	run.Sources = append(run.Sources, countriesFetch, ratesFetch)
+
+	if err := errors.Join(countriesErr, ratesErr); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// fetchCountries fetches the countries opts asks for, and whether they changed
+func (s *CountryService) fetchCountries(ctx context.Context, opts RefreshOptions) ([]models.CountryAPIResponse, FetchResult, error) {
+	switch opts.Scope {
+	case models.ScopeCountry:
+		countries, err := s.apiClient.FetchCountriesByName(ctx, opts.Target)
+		return countries, FetchResult{Changed: true}, err
+	case models.ScopeRegion:
+		countries, err := s.apiClient.FetchCountriesByRegion(ctx, opts.Target)
+		return countries, FetchResult{Changed: true}, err
+	default:
+		return s.apiClient.FetchCountries(ctx, opts.fetchMode())
+	}
+}
+
+// matchTarget keeps the fetched countries a partial refresh targets. The
+// upstream per-name endpoint also returns partial matches, and without
+// per-region endpoints the whole feed comes back.
+func matchTarget(countries []models.CountryAPIResponse, opts RefreshOptions) []models.CountryAPIResponse {
+	matched := []models.CountryAPIResponse{}
+	for _, country := range countries {
+		value := country.Name
+		if opts.Scope == models.ScopeRegion {
+			value = country.Region
+		}
+		if strings.EqualFold(value, opts.Target) {
+			matched = append(matched, country)
+		}
+	}
+	return matched
+}
+
+// timeFetch runs fetch and records its duration and outcome
+func timeFetch(source string, fetch func() (bool, error)) (models.SourceFetch, error) {
+	record := models.SourceFetch{Source: source, StartedAt: time.Now()}
+
+	changed, err := fetch()
+	record.DurationMs = time.Since(record.StartedAt).Milliseconds()
+	record.Changed = changed
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record, err
+}
+
 func (s *CountryService) transformCountry(
 	apiCountry models.CountryAPIResponse,
 	exchangeRates map[string]float64,
@@ -81,22 +564,30 @@ func (s *CountryService) transformCountry(
 		currencyCode := apiCountry.Currencies[0].Code
 		if currencyCode != "" {
 			country.CurrencyCode = &currencyCode
-
-			if rate, exists := exchangeRates[currencyCode]; exists {
-				country.ExchangeRate = &rate
-
-				gdp := s.calculateEstimatedGDP(apiCountry.Population, rate)
-				country.EstimatedGDP = &gdp
-			} else {
-				country.ExchangeRate = nil
-				country.EstimatedGDP = nil
-			}
+			s.applyRate(&country, exchangeRates)
 		}
 	}
 
 	return country
 }
 
+// applyRate sets the exchange rate and estimated GDP of country from its
+// currency code, or clears both when the code has no rate
+func (s *CountryService) applyRate(country *models.Country, exchangeRates map[string]float64) {
+	country.ExchangeRate = nil
+	country.EstimatedGDP = nil
+	if country.CurrencyCode == nil {
+		return
+	}
+
+	if rate, exists := exchangeRates[*country.CurrencyCode]; exists {
+		country.ExchangeRate = &rate
+
+		gdp := s.calculateEstimatedGDP(country.Population, rate)
+		country.EstimatedGDP = &gdp
+	}
+}
+
 func (s *CountryService) calculateEstimatedGDP(population int64, exchangeRate float64) float64 {
 	// Note: Using random multiplier for GDP estimation is not ideal
 	// Consider using a deterministic calculation based on real economic data
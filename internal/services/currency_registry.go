@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"countryCurrency/internal/models"
+)
+
+//go:embed iso4217.csv
+var iso4217CSV []byte
+
+// CurrencyRegistry is the ISO 4217 table embedded in the binary, covering
+// active codes and the withdrawn codes upstream sources still use
+type CurrencyRegistry struct {
+	byCode map[string]models.ISOCurrency
+}
+
+// NewCurrencyRegistry parses the embedded ISO 4217 table
+func NewCurrencyRegistry() (*CurrencyRegistry, error) {
+	records, err := csv.NewReader(bytes.NewReader(iso4217CSV)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ISO 4217 table: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("ISO 4217 table is empty")
+	}
+
+	registry := &CurrencyRegistry{byCode: make(map[string]models.ISOCurrency, len(records)-1)}
+	for line, record := range records[1:] {
+		minorUnits, err := strconv.Atoi(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("ISO 4217 table line %d: invalid minor units %q", line+2, record[2])
+		}
+
+		registry.byCode[record[0]] = models.ISOCurrency{
+			Code:       record[0],
+			Numeric:    record[1],
+			MinorUnits: minorUnits,
+			Name:       record[3],
+			Withdrawn:  record[4] == "true",
+			Successor:  record[5],
+		}
+	}
+
+	for code, currency := range registry.byCode {
+		if currency.Successor == "" {
+			continue
+		}
+		if _, ok := registry.byCode[currency.Successor]; !ok {
+			return nil, fmt.Errorf("ISO 4217 table: successor %s of %s is not in the table", currency.Successor, code)
+		}
+	}
+
+	for code, currency := range registry.byCode {
+		if currency.Withdrawn {
+			current, _ := registry.Resolve(code)
+			currency.Current = current.Code
+			registry.byCode[code] = currency
+		}
+	}
+
+	return registry, nil
+}
+
+// Lookup returns the entry for code, ignoring case and surrounding spaces
+func (r *CurrencyRegistry) Lookup(code string) (models.ISOCurrency, bool) {
+	currency, ok := r.byCode[strings.ToUpper(strings.TrimSpace(code))]
+	return currency, ok
+}
+
+// Resolve returns the entry for code, following withdrawn codes to their
+// current successor (ZWD → ZWN → ZWR → ZWL → ZWG)
+func (r *CurrencyRegistry) Resolve(code string) (models.ISOCurrency, bool) {
+	currency, ok := r.Lookup(code)
+	if !ok {
+		return currency, false
+	}
+
+	// The chain is bounded by the table size, which also guards against cycles
+	for range len(r.byCode) {
+		if !currency.Withdrawn || currency.Successor == "" {
+			break
+		}
+		currency = r.byCode[currency.Successor]
+	}
+
+	return currency, true
+}
+
+// All returns the table sorted by code, leaving out withdrawn codes unless asked
+func (r *CurrencyRegistry) All(includeWithdrawn bool) []models.ISOCurrency {
+	currencies := make([]models.ISOCurrency, 0, len(r.byCode))
+	for _, currency := range r.byCode {
+		if currency.Withdrawn && !includeWithdrawn {
+			continue
+		}
+		currencies = append(currencies, currency)
+	}
+
+	sort.Slice(currencies, func(i, j int) bool { return currencies[i].Code < currencies[j].Code })
+	return currencies
+}
@@ -0,0 +1,64 @@
+package services
+
+import "testing"
+
+func newTestRegistry(t *testing.T) *CurrencyRegistry {
+	t.Helper()
+	registry, err := NewCurrencyRegistry()
+	if err != nil {
+		t.Fatalf("NewCurrencyRegistry: %v", err)
+	}
+	return registry
+}
+
+func TestCurrencyRegistryResolve(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := []struct {
+		code    string
+		want    string
+		wantOK  bool
+		comment string
+	}{
+		{"USD", "USD", true, "active code"},
+		{"usd", "USD", true, "lower case"},
+		{" eur ", "EUR", true, "surrounding spaces"},
+		{"HRK", "EUR", true, "withdrawn with an active successor"},
+		{"SLL", "SLE", true, "redenomination"},
+		{"ZWL", "ZWG", true, "one step"},
+		{"ZWD", "ZWG", true, "chain ZWD → ZWN → ZWR → ZWL → ZWG"},
+		{"ATL", "", false, "unknown code"},
+		{"", "", false, "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.comment, func(t *testing.T) {
+			got, ok := registry.Resolve(tt.code)
+			if ok != tt.wantOK {
+				t.Fatalf("Resolve(%q) ok = %v, want %v", tt.code, ok, tt.wantOK)
+			}
+			if ok && got.Code != tt.want {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.code, got.Code, tt.want)
+			}
+			if ok && got.Withdrawn {
+				t.Errorf("Resolve(%q) = %s, which is withdrawn", tt.code, got.Code)
+			}
+		})
+	}
+}
+
+func TestCurrencyRegistryRecordsCurrentCode(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	zwd, ok := registry.Lookup("ZWD")
+	if !ok {
+		t.Fatal("Lookup(ZWD) not found")
+	}
+	if !zwd.Withdrawn || zwd.Successor != "ZWN" || zwd.Current != "ZWG" {
+		t.Errorf("ZWD = %+v, want withdrawn with successor ZWN and current ZWG", zwd)
+	}
+
+	if usd, _ := registry.Lookup("USD"); usd.Current != "" {
+		t.Errorf("USD.Current = %q, want empty for an active code", usd.Current)
+	}
+}
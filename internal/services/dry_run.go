@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+// DryRun fetches and transforms upstream data the way RefreshCountries would,
+// and compares the result with the stored countries. Nothing is written: not
+// the database, not the summary image, and not the conditional request cache.
+func (s *CountryService) DryRun(ctx context.Context, opts RefreshOptions) (*models.RefreshDiff, error) {
+	if opts.Scope == "" {
+		opts.Scope = models.ScopeAll
+	}
+	opts.DryRun = true
+
+	stored, err := s.repo.GetAllCountries("", "", "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &models.RefreshDiff{
+		Scope:   opts.Scope,
+		Target:  opts.Target,
+		Sources: []models.SourceFetch{},
+		Added:   []models.Country{},
+		Changed: []models.CountryChange{},
+
+		Kept:        []models.Country{},
+		MarkedStale: []models.Country{},
+		Removed:     []models.Country{},
+
+		Quarantined: []models.RateQuarantine{},
+		Rejected:    []models.Rejection{},
+	}
+
+	// Validation records its rejections on a run; a dry run has none to keep
+	scratch := &models.RefreshRun{}
+	defer func() { diff.Rejected = append(diff.Rejected, scratch.Rejected...) }()
+
+	// screen applies the anomaly check without recording anything
+	screen := func(rates map[string]float64) (map[string]float64, error) {
+		effective, held, err := s.screenRates(s.repo, rates)
+		if err != nil {
+			return nil, err
+		}
+		diff.Quarantined = append(diff.Quarantined, held...)
+		return effective, nil
+	}
+
+	var updated []models.Country
+	seen := map[string]bool{}
+	if opts.Scope == models.ScopeRates {
+		var rates map[string]float64
+		fetch, err := timeFetch("exchange_rates", func() (bool, error) {
+			var err error
+			rates, _, err = s.apiClient.FetchExchangeRates(ctx, opts.fetchMode())
+			return true, err
+		})
+		diff.Sources = append(diff.Sources, fetch)
+		if err != nil {
+			return diff, fmt.Errorf("could not fetch data from exchange rate API: %w", err)
+		}
+
+		if rates, err = s.validateRates(rates, scratch); err != nil {
+			return diff, err
+		}
+
+		if rates, err = screen(rates); err != nil {
+			return diff, err
+		}
+
+		for _, country := range stored {
+			s.applyRate(&country, rates)
+			updated = append(updated, country)
+		}
+	} else {
+		data, err := s.fetchUpstream(ctx, opts, scratch)
+		diff.Sources = scratch.Sources
+		if err != nil {
+			return diff, err
+		}
+
+		if opts.partial() {
+			data.countries = matchTarget(data.countries, opts)
+			if len(data.countries) == 0 {
+				return diff, fmt.Errorf("%w: %s %q", ErrNoMatchingCountries, opts.Scope, opts.Target)
+			}
+		}
+
+		if err := s.validateUpstream(data, scratch); err != nil {
+			return diff, err
+		}
+		for _, name := range data.rejected {
+			seen[strings.ToLower(name)] = true
+		}
+
+		rates, err := screen(data.rates)
+		if err != nil {
+			return diff, err
+		}
+
+		now := time.Now()
+		for _, apiCountry := range data.countries {
+			updated = append(updated, s.transformCountry(apiCountry, rates, now))
+		}
+	}
+
+	existing := make(map[string]models.Country, len(stored))
+	for _, country := range stored {
+		existing[strings.ToLower(country.Name)] = country
+	}
+
+	for _, country := range updated {
+		key := strings.ToLower(country.Name)
+		seen[key] = true
+
+		old, ok := existing[key]
+		if !ok {
+			diff.Added = append(diff.Added, country)
+			continue
+		}
+
+		changes := old.Changes(country)
+		if len(changes) == 0 {
+			diff.Unchanged++
+			continue
+		}
+		diff.Changed = append(diff.Changed, models.CountryChange{Name: old.Name, Fields: changes})
+	}
+
+	// Only a full refresh sees the whole feed, so only it can tell what
+	// disappeared. Like applyMissingPolicy, an empty feed removes nothing.
+	if opts.Scope == models.ScopeAll && len(seen) > 0 {
+		s.diffMissing(diff, stored, seen)
+	}
+
+	return diff, nil
+}
+
+// diffMissing sorts the stored countries missing from the feed by what the
+// missing-country policy would do with them. Countries already stale are left
+// out, unless the policy soft-deletes them too.
+func (s *CountryService) diffMissing(diff *models.RefreshDiff, stored []models.Country, seen map[string]bool) {
+	for _, country := range stored {
+		if seen[strings.ToLower(country.Name)] {
+			continue
+		}
+
+		switch {
+		case s.settings.MissingPolicy == MissingDelete:
+			diff.Removed = append(diff.Removed, country)
+		case country.StaleSince != nil:
+			continue
+		case s.settings.MissingPolicy == MissingStale:
+			diff.MarkedStale = append(diff.MarkedStale, country)
+		default:
+			diff.Kept = append(diff.Kept, country)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+func TestDiffMissing(t *testing.T) {
+	staleSince := time.Now().Add(-24 * time.Hour)
+	stored := []models.Country{
+		{Name: "Nigeria"},
+		{Name: "Oldland"},
+		{Name: "Formerland", StaleSince: &staleSince},
+	}
+	seen := map[string]bool{"nigeria": true}
+
+	names := func(countries []models.Country) []string {
+		var out []string
+		for _, country := range countries {
+			out = append(out, country.Name)
+		}
+		return out
+	}
+
+	tests := []struct {
+		policy               MissingPolicy
+		kept, stale, removed []string
+	}{
+		{policy: MissingKeep, kept: []string{"Oldland"}},
+		{policy: MissingStale, stale: []string{"Oldland"}},
+		{policy: MissingDelete, removed: []string{"Oldland", "Formerland"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			s := &CountryService{settings: RefreshSettings{MissingPolicy: tt.policy}}
+			diff := &models.RefreshDiff{}
+			s.diffMissing(diff, stored, seen)
+
+			for _, check := range []struct {
+				field     string
+				got, want []string
+			}{
+				{"kept", names(diff.Kept), tt.kept},
+				{"marked_stale", names(diff.MarkedStale), tt.stale},
+				{"removed", names(diff.Removed), tt.removed},
+			} {
+				if !slices.Equal(check.got, check.want) {
+					t.Errorf("%s = %q, want %q", check.field, check.got, check.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+)
+
+// ErrFlagNotFound is returned when a country has no flag in the local cache
+var ErrFlagNotFound = errors.New("flag not found")
+
+// maxFlagBytes bounds a downloaded flag, so a broken upstream cannot fill the disk
+const maxFlagBytes = 1 << 20
+
+// flagExtensions are the flag formats the cache accepts, with their file extensions
+var flagExtensions = map[string]string{
+	"image/svg+xml": ".svg",
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+}
+
+// FlagSettings configures the local flag cache
+type FlagSettings struct {
+	// Dir holds downloaded flags under their content hash; when empty no
+	// flags are cached
+	Dir string
+
+	// Concurrency is how many flags are downloaded at once
+	Concurrency int
+
+	// Timeout bounds each flag download
+	Timeout time.Duration
+
+	// LocalURLs points flag_url in responses at GET /countries/:name/flag for
+	// countries whose flag is cached. BaseURL is prepended to that path.
+	LocalURLs bool
+	BaseURL   string
+}
+
+// FlagSyncStats counts what a flag sync did
+type FlagSyncStats struct {
+	Downloaded int
+	Unchanged  int
+	Failed     int
+}
+
+// CachedFlag is a flag file ready to serve
+type CachedFlag struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// FlagCache downloads country flags into a local content-addressed store,
+// for clients that cannot reach the upstream flag host
+type FlagCache struct {
+	repo       *database.Repository
+	settings   FlagSettings
+	httpClient *http.Client
+}
+
+func NewFlagCache(repo *database.Repository, settings FlagSettings) *FlagCache {
+	if settings.Concurrency <= 0 {
+		settings.Concurrency = 1
+	}
+	return &FlagCache{
+		repo:       repo,
+		settings:   settings,
+		httpClient: &http.Client{},
+	}
+}
+
+// Sync downloads the flags of countries. Cached flags are revalidated with
+// their upstream ETag and Last-Modified, and a download whose hash matches
+// the cached file is not written again. With onlyMissing, flags already
+// cached for the same URL are not requested at all.
+func (f *FlagCache) Sync(ctx context.Context, countries []models.CountryAPIResponse, onlyMissing bool) FlagSyncStats {
+	var stats FlagSyncStats
+	if f.settings.Dir == "" {
+		return stats
+	}
+
+	assets, err := f.repo.GetFlagAssets()
+	if err != nil {
+		fmt.Printf("Warning: failed to load flag cache: %v\n", err)
+		stats.Failed = len(countries)
+		return stats
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan models.CountryAPIResponse)
+	for i := 0; i < f.settings.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for country := range jobs {
+				var existing *models.FlagAsset
+				if asset, ok := assets[country.Name]; ok {
+					existing = &asset
+				}
+
+				changed, err := f.syncFlag(ctx, country.Name, country.Flag, existing)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					stats.Failed++
+					fmt.Printf("Warning: failed to cache flag of %s: %v\n", country.Name, err)
+				case changed:
+					stats.Downloaded++
+				default:
+					stats.Unchanged++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for _, country := range countries {
+		if country.Flag == "" {
+			continue
+		}
+		if asset, ok := assets[country.Name]; onlyMissing && ok && asset.SourceURL == country.Flag && f.fileExists(&asset) {
+			stats.Unchanged++
+			continue
+		}
+
+		select {
+		case jobs <- country:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return stats
+}
+
+// syncFlag brings the cached flag of one country up to date and reports
+// whether its content changed
+func (f *FlagCache) syncFlag(ctx context.Context, name, source string, existing *models.FlagAsset) (bool, error) {
+	ctx, cancel := withTimeout(ctx, f.settings.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	cached := existing != nil && existing.SourceURL == source && f.fileExists(existing)
+	if cached {
+		if existing.ETag != "" {
+			req.Header.Set("If-None-Match", existing.ETag)
+		}
+		if existing.LastModified != "" {
+			req.Header.Set("If-Modified-Since", existing.LastModified)
+		}
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch flag: %w", err)
+	}
+	defer resp.Body.Close()
+
+	now := time.Now()
+	if resp.StatusCode == http.StatusNotModified && cached {
+		existing.FetchedAt = now
+		return false, f.repo.SaveFlagAsset(existing)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("flag host returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFlagBytes+1))
+	if err != nil {
+		return false, fmt.Errorf("failed to read flag: %w", err)
+	}
+	if len(body) > maxFlagBytes {
+		return false, fmt.Errorf("flag is larger than %d bytes", maxFlagBytes)
+	}
+
+	contentType, err := flagContentType(resp.Header.Get("Content-Type"), source)
+	if err != nil {
+		return false, err
+	}
+
+	asset := &models.FlagAsset{
+		CountryName:  name,
+		SourceURL:    source,
+		Hash:         contentHash(body),
+		ContentType:  contentType,
+		SizeBytes:    len(body),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    now,
+		ChangedAt:    now,
+	}
+
+	if cached && existing.Hash == asset.Hash && existing.ContentType == asset.ContentType {
+		asset.ChangedAt = existing.ChangedAt
+		return false, f.repo.SaveFlagAsset(asset)
+	}
+
+	if !f.fileExists(asset) {
+		filePath := f.path(asset)
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return false, fmt.Errorf("failed to create flag directory: %w", err)
+		}
+		if err := writeFileAtomic(filePath, body); err != nil {
+			return false, err
+		}
+	}
+
+	if err := f.repo.SaveFlagAsset(asset); err != nil {
+		return false, err
+	}
+
+	if existing != nil && existing.Hash != asset.Hash {
+		f.removeIfUnused(existing)
+	}
+
+	return true, nil
+}
+
+// removeIfUnused deletes the file of a replaced flag unless another country
+// shares it. A file removed while another country adopts it is downloaded
+// again on the next sync, since its missing file fails revalidation.
+func (f *FlagCache) removeIfUnused(asset *models.FlagAsset) {
+	count, err := f.repo.CountFlagAssetsByHash(asset.Hash)
+	if err != nil || count > 0 {
+		return
+	}
+	if err := os.Remove(f.path(asset)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Warning: failed to remove replaced flag: %v\n", err)
+	}
+}
+
+// Remove deletes the files of flags whose rows were deleted with their
+// countries, unless another country shares them
+func (f *FlagCache) Remove(assets []models.FlagAsset) {
+	if f.settings.Dir == "" {
+		return
+	}
+	for i := range assets {
+		f.removeIfUnused(&assets[i])
+	}
+}
+
+// Flag returns the cached flag of the named country
+func (f *FlagCache) Flag(name string) (*CachedFlag, error) {
+	if f.settings.Dir == "" {
+		return nil, ErrFlagNotFound
+	}
+
+	asset, err := f.repo.GetFlagAsset(name)
+	if err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, ErrFlagNotFound
+	}
+
+	data, err := os.ReadFile(f.path(asset))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFlagNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flag: %w", err)
+	}
+
+	return &CachedFlag{
+		Data:        data,
+		ContentType: asset.ContentType,
+		ETag:        `"` + asset.Hash[:32] + `"`,
+		ModTime:     asset.ChangedAt,
+	}, nil
+}
+
+// Localize points the flag_url of countries with a cached flag at the local
+// copy, when LocalURLs is set
+func (f *FlagCache) Localize(countries []models.Country) error {
+	if !f.settings.LocalURLs || f.settings.Dir == "" {
+		return nil
+	}
+
+	assets, err := f.repo.GetFlagAssets()
+	if err != nil {
+		return err
+	}
+
+	for i := range countries {
+		if _, ok := assets[countries[i].Name]; !ok {
+			continue
+		}
+		local := f.settings.BaseURL + "/countries/" + url.PathEscape(countries[i].Name) + "/flag"
+		countries[i].FlagURL = &local
+	}
+	return nil
+}
+
+// path is <dir>/<first two hex digits>/<hash><extension>
+func (f *FlagCache) path(asset *models.FlagAsset) string {
+	return filepath.Join(f.settings.Dir, asset.Hash[:2], asset.Hash+flagExtensions[asset.ContentType])
+}
+
+func (f *FlagCache) fileExists(asset *models.FlagAsset) bool {
+	_, err := os.Stat(f.path(asset))
+	return err == nil
+}
+
+// flagContentType takes the type the flag host declared, falling back to the
+// extension of the URL when the host sends a generic type
+func flagContentType(header, source string) (string, error) {
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+		if _, ok := flagExtensions[mediaType]; ok {
+			return mediaType, nil
+		}
+	}
+
+	if u, err := url.Parse(source); err == nil {
+		ext := strings.ToLower(path.Ext(u.Path))
+		for contentType, known := range flagExtensions {
+			if ext == known || (ext == ".jpeg" && known == ".jpg") {
+				return contentType, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("unsupported flag type %q", header)
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// fontSet holds the parsed fonts summary images are drawn with. The embedded
+// Go fonts (BSD licensed) cover Latin, Greek and Cyrillic, so names such as
+// "Côte d'Ivoire" and "Åland Islands" render correctly.
+type fontSet struct {
+	regular *opentype.Font
+	bold    *opentype.Font
+
+	// family names the font in SVG output
+	family string
+}
+
+// loadFonts parses the embedded Go fonts, or the TrueType/OpenType font at
+// path when one is configured. A custom font is used for both weights.
+func loadFonts(path string) (*fontSet, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font %s: %w", path, err)
+		}
+		custom, err := opentype.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse font %s: %w", path, err)
+		}
+
+		family, err := custom.Name(nil, sfnt.NameIDFamily)
+		if err != nil {
+			family = ""
+		}
+		return &fontSet{regular: custom, bold: custom, family: family}, nil
+	}
+
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse embedded font: %w", err)
+	}
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse embedded bold font: %w", err)
+	}
+	return &fontSet{regular: regular, bold: bold, family: "Go"}, nil
+}
+
+// faceCache creates font faces on first use. Faces are not safe for
+// concurrent use, so each rendering gets its own cache.
+type faceCache struct {
+	fonts *fontSet
+	faces map[faceKey]font.Face
+}
+
+type faceKey struct {
+	size float64
+	bold bool
+}
+
+func newFaceCache(fonts *fontSet) *faceCache {
+	return &faceCache{fonts: fonts, faces: map[faceKey]font.Face{}}
+}
+
+// face returns a face of size pixels. Should the font refuse the size, the
+// built-in bitmap font is used rather than failing the whole image.
+func (c *faceCache) face(size float64, bold bool) font.Face {
+	key := faceKey{size: size, bold: bold}
+	if face, ok := c.faces[key]; ok {
+		return face
+	}
+
+	f := c.fonts.regular
+	if bold {
+		f = c.fonts.bold
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		fmt.Printf("Warning: failed to create %.1fpx font face: %v\n", size, err)
+		face = basicfont.Face7x13
+	}
+
+	c.faces[key] = face
+	return face
+}
+
+// close releases every face created by the cache
+func (c *faceCache) close() {
+	for _, face := range c.faces {
+		face.Close()
+	}
+}
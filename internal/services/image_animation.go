@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+// ErrNoSnapshots is returned when no refresh in the requested range captured countries
+var ErrNoSnapshots = errors.New("no refresh history in range")
+
+// AnimationOptions selects what the animated summary image shows. A zero
+// From or To leaves that end of the range open.
+type AnimationOptions struct {
+	Metric string
+	Region string
+	Top    int
+	Width  int
+	Height int
+	Frames int
+	From   time.Time
+	To     time.Time
+	Theme  string
+}
+
+// DefaultAnimationOptions are used for parameters a request leaves out
+var DefaultAnimationOptions = AnimationOptions{Metric: models.MetricGDP, Top: 10, Width: 600, Height: 400, Frames: 30}
+
+const (
+	MaxAnimationFrames = 60
+
+	// MaxAnimationPixels bounds width × height × frames, so large
+	// animations get fewer frames rather than unbounded memory
+	MaxAnimationPixels = 48_000_000
+
+	// Frame delays, in hundredths of a second. The last frame is held so
+	// the loop visibly restarts.
+	animationFrameDelay     = 80
+	animationLastFrameDelay = 300
+)
+
+// RenderAnimation renders a GIF with one bar chart per refresh in range, all
+// on the same value axis, so the bars race as the data changes. When there
+// are more refreshes than frames, frames are spread evenly over them, always
+// keeping the first and the last.
+func (s *ImageService) RenderAnimation(opts AnimationOptions) ([]byte, error) {
+	metric, ok := imageMetrics[opts.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", opts.Metric)
+	}
+	if opts.Theme == "" {
+		opts.Theme = s.settings.Theme
+	}
+	theme, ok := s.themes[opts.Theme]
+	if !ok {
+		return nil, fmt.Errorf("unknown theme %q", opts.Theme)
+	}
+
+	version, err := s.repo.GetDataVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	frames := max(1, min(opts.Frames, MaxAnimationPixels/(opts.Width*opts.Height)))
+	key := fmt.Sprintf("animated|%s|%s|%d|%dx%d|%d|%s|%s|%s|%s",
+		opts.Metric, strings.ToLower(opts.Region), opts.Top, opts.Width, opts.Height, frames,
+		formatRangeEnd(opts.From), formatRangeEnd(opts.To), opts.Theme, version)
+	if data, ok := s.cache.get(key); ok {
+		return data, nil
+	}
+
+	runs, err := s.repo.GetSnapshotRuns(opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, ErrNoSnapshots
+	}
+	runs = sampleRuns(runs, frames)
+
+	title := fmt.Sprintf("Top %d countries by %s", opts.Top, metric.label)
+	if opts.Region != "" {
+		title = fmt.Sprintf("Top %d countries in %s by %s", opts.Top, opts.Region, metric.label)
+	}
+	title = theme.titleFor(title)
+
+	charts := make([]barChart, 0, len(runs))
+	axisMax := 0.0
+	for i, run := range runs {
+		countries, err := s.repo.GetTopSnapshotCountries(run.RunID, opts.Metric, opts.Region, opts.Top)
+		if err != nil {
+			return nil, err
+		}
+
+		bars := make([]chartBar, 0, len(countries))
+		for _, country := range countries {
+			bar := chartBar{Label: country.Name, Value: metric.value(country)}
+			if country.Region != nil {
+				bar.Region = *country.Region
+			}
+			axisMax = math.Max(axisMax, bar.Value)
+			bars = append(bars, bar)
+		}
+
+		charts = append(charts, barChart{
+			Title:    title,
+			Subtitle: fmt.Sprintf("As of %s", run.CapturedAt.UTC().Format("2006-01-02 15:04 UTC")),
+			Bars:     bars,
+			Format:   metric.format,
+			Footer:   fmt.Sprintf("Refresh run %d · frame %d of %d", run.RunID, i+1, len(runs)),
+		})
+	}
+
+	faces := newFaceCache(s.fonts)
+	defer faces.close()
+
+	pal := themePalette(theme)
+	anim := &gif.GIF{}
+	for i := range charts {
+		charts[i].AxisMax = axisMax
+
+		c := newRasterCanvas(opts.Width, opts.Height, 1, faces)
+		if err := drawBarChart(c, charts[i], theme); err != nil {
+			return nil, fmt.Errorf("failed to draw frame: %w", err)
+		}
+
+		// Nearest-color mapping rather than dithering keeps flat areas flat
+		frame := image.NewPaletted(c.img.Bounds(), pal)
+		draw.Draw(frame, frame.Rect, c.img, image.Point{}, draw.Src)
+
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, animationFrameDelay)
+	}
+	anim.Delay[len(anim.Delay)-1] = animationLastFrameDelay
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, fmt.Errorf("failed to encode animation: %w", err)
+	}
+
+	s.cache.add(key, buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// sampleRuns picks n runs spread evenly over runs, keeping the first and last
+func sampleRuns(runs []models.SnapshotRun, n int) []models.SnapshotRun {
+	if len(runs) <= n {
+		return runs
+	}
+	if n == 1 {
+		return runs[len(runs)-1:]
+	}
+
+	sampled := make([]models.SnapshotRun, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, runs[round(float64(i)*float64(len(runs)-1)/float64(n-1))])
+	}
+	return sampled
+}
+
+// themePalette starts with the exact colors of theme, so backgrounds and bars
+// are not shifted, then the text colors blended into the background for
+// anti-aliased edges, and fills up with the Plan 9 palette
+func themePalette(theme *chartTheme) color.Palette {
+	solid := []color.RGBA{theme.background, theme.text, theme.mutedText, theme.gridline, theme.axis, theme.otherRegion}
+
+	regions := make([]string, 0, len(theme.regions))
+	for region := range theme.regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		solid = append(solid, theme.regions[region])
+	}
+
+	colors := make([]color.Color, 0, len(solid))
+	for _, c := range solid {
+		colors = append(colors, c)
+	}
+	for _, fg := range []color.RGBA{theme.text, theme.mutedText} {
+		for _, t := range []float64{0.2, 0.4, 0.6, 0.8} {
+			colors = append(colors, blend(theme.background, fg, t))
+		}
+	}
+	colors = append(colors, palette.Plan9...)
+
+	pal := make(color.Palette, 0, 256)
+	seen := map[color.RGBA]bool{}
+	for _, c := range colors {
+		rgba := color.RGBAModel.Convert(c).(color.RGBA)
+		rgba.A = 255
+		if seen[rgba] {
+			continue
+		}
+		seen[rgba] = true
+		pal = append(pal, rgba)
+		if len(pal) == 256 {
+			break
+		}
+	}
+	return pal
+}
+
+// blend mixes t of b into a
+func blend(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x)*(1-t) + float64(y)*t))
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+func formatRangeEnd(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
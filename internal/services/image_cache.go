@@ -0,0 +1,72 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+)
+
+// imageCache is a least-recently-used cache of rendered images, bounded by
+// both entry count and total bytes
+type imageCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	order      *list.List // front is most recently used
+	items      map[string]*list.Element
+}
+
+type cachedImage struct {
+	key  string
+	data []byte
+}
+
+// newImageCache creates a cache; a zero bound disables caching
+func newImageCache(maxEntries int, maxBytes int64) *imageCache {
+	return &imageCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (c *imageCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedImage).data, true
+}
+
+// add stores data under key, evicting the least recently used images until
+// the cache is within its bounds. Images larger than the byte bound are not kept.
+func (c *imageCache) add(key string, data []byte) {
+	if c.maxEntries <= 0 || int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.size += int64(len(data)) - int64(len(elem.Value.(*cachedImage).data))
+		elem.Value.(*cachedImage).data = data
+		c.order.MoveToFront(elem)
+	} else {
+		c.items[key] = c.order.PushFront(&cachedImage{key: key, data: data})
+		c.size += int64(len(data))
+	}
+
+	for c.order.Len() > c.maxEntries || c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cachedImage)
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+)
+
+// keepHistory stores data under its content hash, links it to runID and
+// prunes the history. Callers hold generateMu, so pruning never races a
+// write of the same content.
+func (s *ImageService) keepHistory(runID int64, data []byte) error {
+	img := &models.SummaryImage{
+		RunID:     runID,
+		Hash:      contentHash(data),
+		Format:    models.ImageFormatPNG,
+		SizeBytes: len(data),
+		CreatedAt: time.Now(),
+	}
+
+	path := s.historyPath(img)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create history directory: %w", err)
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.InsertSummaryImage(img); err != nil {
+		return err
+	}
+
+	return s.pruneHistory()
+}
+
+// pruneHistory applies the retention settings and removes the files no
+// remaining history entry uses
+func (s *ImageService) pruneHistory() error {
+	var cutoff time.Time
+	if s.settings.HistoryMaxAge > 0 {
+		cutoff = time.Now().Add(-s.settings.HistoryMaxAge)
+	}
+	if s.settings.HistoryKeep <= 0 && cutoff.IsZero() {
+		return nil
+	}
+
+	var orphaned []models.SummaryImage
+	err := s.repo.WithTx(context.Background(), func(tx *database.Repository) error {
+		var err error
+		orphaned, err = tx.PruneSummaryImages(s.settings.HistoryKeep, cutoff)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range orphaned {
+		if err := os.Remove(s.historyPath(&orphaned[i])); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("Warning: failed to remove pruned summary image: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// ImageHistory lists the most recent images in the history, newest first
+func (s *ImageService) ImageHistory(limit int) ([]models.SummaryImage, error) {
+	images, err := s.repo.GetSummaryImages(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range images {
+		images[i].URL = runImageURL(images[i].RunID)
+	}
+	return images, nil
+}
+
+// RunImage returns the summary image generated by a refresh run
+func (s *ImageService) RunImage(runID int64) (*StoredImage, error) {
+	img, err := s.repo.GetSummaryImageByRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		return nil, ErrImageNotFound
+	}
+
+	data, err := os.ReadFile(s.historyPath(img))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	return &StoredImage{Data: data, ETag: ImageETag(data), ModTime: img.CreatedAt}, nil
+}
+
+// historyPath is <dir>/<first two hex digits>/<hash>.<format>, so no single
+// directory grows too large
+func (s *ImageService) historyPath(img *models.SummaryImage) string {
+	return filepath.Join(s.settings.HistoryDir, img.Hash[:2], img.Hash+"."+img.Format)
+}
+
+func runImageURL(runID int64) string {
+	return fmt.Sprintf("/countries/image/%d", runID)
+}
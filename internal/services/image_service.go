@@ -1,110 +1,444 @@
 package services
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"image"
-	"image/color"
-	"image/png"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+)
+
+// ImageSettings configures how summary images are rendered and cached
+type ImageSettings struct {
+	// Path is where the summary image generated on refresh is written
+	Path string
+
+	// FontPath selects a TrueType/OpenType font; when empty the embedded Go fonts are used
+	FontPath string
+
+	// CacheEntries and CacheBytes bound the cache of on-demand renders
+	CacheEntries int
+	CacheBytes   int64
+
+	// JPEGQuality is used for JPEG renders that do not ask for a quality
+	JPEGQuality int
+
+	// ThemesPath is a YAML or JSON file of themes added to light and dark;
+	// Theme is the one used when a request does not name one
+	ThemesPath string
+	Theme      string
+
+	// HistoryDir keeps the image of every refresh run under its content hash;
+	// when empty no history is kept
+	HistoryDir string
+
+	// HistoryKeep and HistoryMaxAge prune the history to the newest entries
+	// and to recent ones; zero disables each rule
+	HistoryKeep   int
+	HistoryMaxAge time.Duration
+}
+
+// ImageOptions selects what a summary image shows and how large it is
+type ImageOptions struct {
+	Metric string
+	Region string
+	Top    int
+	Width  int
+	Height int
+	Format string
+
+	// Scale multiplies the pixel density, e.g. 2 for retina screens
+	Scale int
+
+	// Quality is the JPEG quality, 1–100; zero uses the configured default
+	Quality int
+
+	// Theme names the colors, logo and margins; empty uses the configured default
+	Theme string
+}
+
+// DefaultImageOptions describe the summary image generated on refresh
+var DefaultImageOptions = ImageOptions{Metric: models.MetricGDP, Top: 5, Width: 600, Height: 400, Format: models.ImageFormatPNG, Scale: 1}
 
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/math/fixed"
+// imageContentTypes maps each output format to its MIME type
+var imageContentTypes = map[string]string{
+	models.ImageFormatPNG:  "image/png",
+	models.ImageFormatSVG:  "image/svg+xml",
+	models.ImageFormatJPEG: "image/jpeg",
+}
+
+// ContentType returns the MIME type of images rendered in format
+func ContentType(format string) string {
+	return imageContentTypes[format]
+}
+
+// Bounds on image options, so a request cannot make the server render huge images
+const (
+	MaxImageTop    = 50
+	MinImageWidth  = 200
+	MaxImageWidth  = 2000
+	MinImageHeight = 150
+	MaxImageHeight = 2000
+	MaxImageScale  = 3
+
+	// MaxImagePixels bounds the rendered raster size, scale included
+	MaxImagePixels = 4_000_000
 )
 
+// imageMetric is how a metric is labelled, read from a country and formatted
+type imageMetric struct {
+	label  string
+	value  func(models.Country) float64
+	format func(float64) string
+}
+
+var imageMetrics = map[string]imageMetric{
+	models.MetricGDP: {
+		label:  "estimated GDP",
+		value:  func(c models.Country) float64 { return *c.EstimatedGDP },
+		format: formatMoney,
+	},
+	models.MetricPopulation: {
+		label:  "population",
+		value:  func(c models.Country) float64 { return float64(c.Population) },
+		format: formatCompact,
+	},
+	models.MetricGDPPerCapita: {
+		label:  "GDP per capita",
+		value:  func(c models.Country) float64 { return *c.EstimatedGDP / float64(c.Population) },
+		format: formatMoney,
+	},
+	models.MetricExchangeRate: {
+		label:  "exchange rate to USD",
+		value:  func(c models.Country) float64 { return *c.ExchangeRate },
+		format: formatCompact,
+	},
+}
+
+// ErrImageNotFound is returned when no summary image has been generated yet
+var ErrImageNotFound = errors.New("summary image not found")
+
+// StoredImage is the summary image on disk with its validators
+type StoredImage struct {
+	Data    []byte
+	ETag    string
+	ModTime time.Time
+}
+
 type ImageService struct {
-	repo      *database.Repository
-	imagePath string
+	repo     *database.Repository
+	settings ImageSettings
+	fonts    *fontSet
+	themes   map[string]*chartTheme
+	cache    *imageCache
+
+	// generateMu serializes generation; mu guards swapping the file and
+	// summary, so served bytes always match their ETag
+	generateMu sync.Mutex
+	mu         sync.RWMutex
+	summary    *StoredImage
 }
 
-func NewImageService(repo *database.Repository, imagePath string) *ImageService {
+func NewImageService(repo *database.Repository, settings ImageSettings) (*ImageService, error) {
+	fonts, err := loadFonts(settings.FontPath)
+	if err != nil {
+		return nil, err
+	}
+
+	themes, err := loadThemes(settings.ThemesPath)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Theme == "" {
+		settings.Theme = ThemeLight
+	}
+	if _, ok := themes[settings.Theme]; !ok {
+		return nil, fmt.Errorf("unknown default theme %q", settings.Theme)
+	}
+
 	return &ImageService{
-		repo:      repo,
-		imagePath: imagePath,
+		repo:     repo,
+		settings: settings,
+		fonts:    fonts,
+		themes:   themes,
+		cache:    newImageCache(settings.CacheEntries, settings.CacheBytes),
+	}, nil
+}
+
+// GenerateSummaryImage renders the default summary image to the configured
+// path. The file is replaced atomically, so readers see the old or the new
+// image, never a partial one. A non-zero runID also keeps the image in the
+// history of that refresh run.
+func (s *ImageService) GenerateSummaryImage(runID int64) error {
+	s.generateMu.Lock()
+	defer s.generateMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := s.render(DefaultImageOptions, &buf); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.settings.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	if err := s.publish(buf.Bytes()); err != nil {
+		return err
+	}
+
+	if runID != 0 && s.settings.HistoryDir != "" {
+		if err := s.keepHistory(runID, buf.Bytes()); err != nil {
+			fmt.Printf("Warning: failed to keep summary image of run %d: %v\n", runID, err)
+		}
 	}
+
+	return nil
 }
 
-func (s *ImageService) GenerateSummaryImage() error {
-	totalCountries, err := s.repo.GetTotalCountries()
+// publish replaces the summary image file and the copy served from memory.
+// The copy is read back from the file, so its ModTime matches what a later
+// stat sees even when another replica wrote in between.
+func (s *ImageService) publish(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := writeFileAtomic(s.settings.Path, data); err != nil {
+		return fmt.Errorf("failed to write image: %w", err)
+	}
+
+	summary, err := readStoredImage(s.settings.Path)
 	if err != nil {
-		return fmt.Errorf("failed to get total countries: %w", err)
+		return err
 	}
+	s.summary = summary
 
-	topCountries, err := s.repo.GetTopCountriesByGDP(5)
+	return nil
+}
+
+// SummaryImage returns the summary image generated on refresh. The copy in
+// memory is used while the file keeps its size and modification time;
+// otherwise the file is read again, so an image written by another replica,
+// or by a previous process, is picked up.
+func (s *ImageService) SummaryImage() (*StoredImage, error) {
+	info, err := os.Stat(s.settings.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrImageNotFound
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get top countries: %w", err)
+		return nil, fmt.Errorf("failed to stat image: %w", err)
 	}
 
-	lastRefresh, err := s.repo.GetLastRefreshedAt()
+	s.mu.RLock()
+	summary := s.summary
+	s.mu.RUnlock()
+	if summary.matches(info) {
+		return summary, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.summary.matches(info) {
+		return s.summary, nil
+	}
+
+	summary, err = readStoredImage(s.settings.Path)
+	if err != nil {
+		return nil, err
+	}
+	s.summary = summary
+	return s.summary, nil
+}
+
+// matches reports whether img was read from a file with the size and
+// modification time in info
+func (img *StoredImage) matches(info os.FileInfo) bool {
+	return img != nil && int64(len(img.Data)) == info.Size() && img.ModTime.Equal(info.ModTime())
+}
+
+// readStoredImage reads the image at path, taking its modification time from
+// the same open file so data and ModTime always belong together
+func readStoredImage(path string) (*StoredImage, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat image: %w", err)
+	}
+	data, err := io.ReadAll(file)
 	if err != nil {
-		return fmt.Errorf("failed to get last refresh time: %w", err)
+		return nil, fmt.Errorf("failed to read image: %w", err)
 	}
 
-	width, height := 600, 400
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	return &StoredImage{Data: data, ETag: ImageETag(data), ModTime: info.ModTime()}, nil
+}
 
-	s.fillBackground(img, color.White)
+// ImageETag returns a strong ETag derived from the image content
+func ImageETag(data []byte) string {
+	return `"` + contentHash(data)[:32] + `"`
+}
 
-	y := 30
-	y = s.drawText(img, fmt.Sprintf("Total countries: %d", totalCountries), 20, y, color.Black)
-	y += 20
-	y = s.drawText(img, "Top 5 countries by GDP:", 20, y, color.Black)
-	y += 10
+// contentHash is the hex SHA-256 of data, which names history files
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
 
-	for i, country := range topCountries {
-		gdp := "N/A"
-		if country.EstimatedGDP != nil {
-			gdp = fmt.Sprintf("$%.2f", *country.EstimatedGDP)
-		}
-		text := fmt.Sprintf("%d. %s - %s", i+1, country.Name, gdp)
-		y = s.drawText(img, text, 40, y, color.RGBA{50, 50, 50, 255})
-		y += 5
+// RenderImage renders opts on demand. Renders are cached until the stored
+// country data changes.
+func (s *ImageService) RenderImage(opts ImageOptions) ([]byte, error) {
+	version, err := s.repo.GetDataVersion()
+	if err != nil {
+		return nil, err
 	}
 
-	y += 20
-	s.drawText(img, fmt.Sprintf("last refreshed: %s", lastRefresh.Format("2006-01-02 15:04:05")), 20, y, color.RGBA{100, 100, 100, 255})
+	opts = s.withDefaults(opts)
+	key := fmt.Sprintf("%s|%s|%d|%dx%d@%d|%s:%d|%s|%s",
+		opts.Metric, strings.ToLower(opts.Region), opts.Top, opts.Width, opts.Height, opts.Scale, opts.Format, opts.Quality, opts.Theme, version)
+	if data, ok := s.cache.get(key); ok {
+		return data, nil
+	}
 
-	if err := os.MkdirAll(filepath.Dir(s.imagePath), 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+	var buf bytes.Buffer
+	if err := s.render(opts, &buf); err != nil {
+		return nil, err
+	}
+
+	s.cache.add(key, buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// withDefaults fills in the scale, the theme and, for JPEG, the quality
+func (s *ImageService) withDefaults(opts ImageOptions) ImageOptions {
+	if opts.Scale <= 0 {
+		opts.Scale = 1
 	}
+	if opts.Theme == "" {
+		opts.Theme = s.settings.Theme
+	}
+	if opts.Format != models.ImageFormatJPEG {
+		opts.Quality = 0
+	} else if opts.Quality <= 0 {
+		opts.Quality = s.settings.JPEGQuality
+	}
+	return opts
+}
 
-	file, err := os.Create(s.imagePath)
+// render draws the bar chart opts describes and encodes it into buf
+func (s *ImageService) render(opts ImageOptions, buf *bytes.Buffer) error {
+	opts = s.withDefaults(opts)
+	theme, ok := s.themes[opts.Theme]
+	if !ok {
+		return fmt.Errorf("unknown theme %q", opts.Theme)
+	}
+
+	chart, err := s.chartFor(opts)
 	if err != nil {
-		return fmt.Errorf("failed to create image file: %w", err)
+		return err
 	}
-	defer file.Close()
+	chart.Title = theme.titleFor(chart.Title)
+
+	faces := newFaceCache(s.fonts)
+	defer faces.close()
 
-	if err := png.Encode(file, img); err != nil {
+	var c canvas
+	switch opts.Format {
+	case models.ImageFormatSVG:
+		c = newSVGCanvas(opts.Width, opts.Height, float64(opts.Scale), chart.Title, faces)
+	case models.ImageFormatPNG, "":
+		c = newRasterCanvas(opts.Width, opts.Height, float64(opts.Scale), faces)
+	case models.ImageFormatJPEG:
+		raster := newRasterCanvas(opts.Width, opts.Height, float64(opts.Scale), faces)
+		raster.jpegQuality = opts.Quality
+		c = raster
+	default:
+		return fmt.Errorf("unknown image format %q", opts.Format)
+	}
+
+	if err := drawBarChart(c, chart, theme); err != nil {
+		return fmt.Errorf("failed to draw chart: %w", err)
+	}
+	if err := c.encode(buf); err != nil {
 		return fmt.Errorf("failed to encode image: %w", err)
 	}
 
 	return nil
 }
 
-func (s *ImageService) fillBackground(img *image.RGBA, col color.Color) {
-	bounds := img.Bounds()
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			img.Set(x, y, col)
-		}
+// ThemeNames lists the themes requests can select, sorted
+func (s *ImageService) ThemeNames() []string {
+	names := make([]string, 0, len(s.themes))
+	for name := range s.themes {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-func (s *ImageService) drawText(img *image.RGBA, text string, x, y int, col color.Color) int {
-	d := &font.Drawer{
-		Dst:  img,
-		Src:  image.NewUniform(col),
-		Face: basicfont.Face7x13,
-		Dot:  fixed.Point26_6{X: fixed.I(x), Y: fixed.I(y)},
+// chartFor loads the countries opts ranks and lays them out as a bar chart
+func (s *ImageService) chartFor(opts ImageOptions) (barChart, error) {
+	metric, ok := imageMetrics[opts.Metric]
+	if !ok {
+		return barChart{}, fmt.Errorf("unknown metric %q", opts.Metric)
 	}
-	d.DrawString(text)
 
-	return y + 20
-}
+	var totalCountries int
+	var err error
+	if opts.Region != "" {
+		totalCountries, err = s.repo.GetTotalCountriesInRegion(opts.Region)
+	} else {
+		totalCountries, err = s.repo.GetTotalCountries()
+	}
+	if err != nil {
+		return barChart{}, fmt.Errorf("failed to get total countries: %w", err)
+	}
+
+	topCountries, err := s.repo.GetTopCountriesByMetric(opts.Metric, opts.Region, opts.Top)
+	if err != nil {
+		return barChart{}, fmt.Errorf("failed to get top countries: %w", err)
+	}
+
+	lastRefresh, err := s.repo.GetLastRefreshedAt()
+	if err != nil {
+		return barChart{}, fmt.Errorf("failed to get last refresh time: %w", err)
+	}
+
+	bars := make([]chartBar, 0, len(topCountries))
+	for _, country := range topCountries {
+		bar := chartBar{Label: country.Name, Value: metric.value(country)}
+		if country.Region != nil {
+			bar.Region = *country.Region
+		}
+		bars = append(bars, bar)
+	}
+
+	chart := barChart{
+		Title:    fmt.Sprintf("Top %d countries by %s", len(bars), metric.label),
+		Subtitle: fmt.Sprintf("%d countries in total", totalCountries),
+		Bars:     bars,
+		Format:   metric.format,
+		Footer:   fmt.Sprintf("Last refreshed %s", lastRefresh.UTC().Format("2006-01-02 15:04 UTC")),
+	}
+	if opts.Region != "" {
+		chart.Title = fmt.Sprintf("Top %d countries in %s by %s", len(bars), opts.Region, metric.label)
+		chart.Subtitle = fmt.Sprintf("%d countries in %s", totalCountries, opts.Region)
+	}
 
-func (s *ImageService) GetImagePath() string {
-	return s.imagePath
+	return chart, nil
 }
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSummaryImageReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.png")
+	s := &ImageService{settings: ImageSettings{Path: path}}
+
+	if _, err := s.SummaryImage(); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("SummaryImage() before generation error = %v, want ErrImageNotFound", err)
+	}
+
+	if err := s.publish([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	first, err := s.SummaryImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.Data) != "first" {
+		t.Fatalf("SummaryImage() = %q, want %q", first.Data, "first")
+	}
+
+	// Another replica replaces the file
+	if err := os.WriteFile(path, []byte("second image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := first.ModTime.Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := s.SummaryImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(second.Data, []byte("second image")) {
+		t.Fatalf("SummaryImage() after replacement = %q, want %q", second.Data, "second image")
+	}
+	if second.ETag == first.ETag || !second.ModTime.Equal(later) {
+		t.Errorf("SummaryImage() kept stale validators: ETag %s, ModTime %v", second.ETag, second.ModTime)
+	}
+
+	if again, _ := s.SummaryImage(); again != second {
+		t.Error("SummaryImage() reread an unchanged file")
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+)
+
+var (
+	// ErrQuarantineNotFound reports an unknown quarantine entry
+	ErrQuarantineNotFound = errors.New("quarantined rate not found")
+
+	// ErrQuarantineResolved reports an entry that was already approved or rejected
+	ErrQuarantineResolved = errors.New("quarantined rate already resolved")
+)
+
+// screenRates compares published rates with the stored ones. A rate that moved
+// more than RateAnomalyPct percent is replaced by the stored rate in the
+// returned map and reported as a pending quarantine entry. rates is not modified.
+func (s *CountryService) screenRates(repo *database.Repository, rates map[string]float64) (map[string]float64, []models.RateQuarantine, error) {
+	if s.settings.RateAnomalyPct <= 0 {
+		effective, held := holdAnomalies(rates, nil, 0, time.Now())
+		return effective, held, nil
+	}
+
+	stored, err := repo.GetStoredRates()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	effective, held := holdAnomalies(rates, stored, s.settings.RateAnomalyPct, time.Now())
+	return effective, held, nil
+}
+
+// holdAnomalies is the comparison behind screenRates: rates that moved more
+// than thresholdPct percent from their stored value keep the stored value and
+// are returned as pending entries, sorted by code. A threshold of zero or less
+// holds nothing back.
+func holdAnomalies(rates, stored map[string]float64, thresholdPct float64, now time.Time) (map[string]float64, []models.RateQuarantine) {
+	effective := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		effective[code] = rate
+	}
+
+	if thresholdPct <= 0 {
+		return effective, nil
+	}
+
+	var held []models.RateQuarantine
+	for code, newRate := range rates {
+		oldRate, ok := stored[code]
+		if !ok || oldRate <= 0 {
+			continue
+		}
+
+		change := math.Abs(newRate-oldRate) / oldRate * 100
+		if change <= thresholdPct {
+			continue
+		}
+
+		effective[code] = oldRate
+		held = append(held, models.RateQuarantine{
+			CurrencyCode: code,
+			OldRate:      oldRate,
+			NewRate:      newRate,
+			ChangePct:    change,
+			Status:       models.QuarantinePending,
+			DetectedAt:   now,
+		})
+	}
+
+	sort.Slice(held, func(i, j int) bool { return held[i].CurrencyCode < held[j].CurrencyCode })
+
+	return effective, held
+}
+
+// quarantineRates screens rates inside a refresh transaction and records the
+// held-back ones as pending entries linked to run
+func (s *CountryService) quarantineRates(tx *database.Repository, rates map[string]float64, run *models.RefreshRun) (map[string]float64, error) {
+	effective, held, err := s.screenRates(tx, rates)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range held {
+		if run.ID != 0 {
+			held[i].RunID = &run.ID
+		}
+		if err := tx.SavePendingQuarantine(&held[i]); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Warning: quarantined %s rate %.6g (stored %.6g, %.1f%% change)\n",
+			held[i].CurrencyCode, held[i].NewRate, held[i].OldRate, held[i].ChangePct)
+	}
+
+	run.Quarantined = len(held)
+	return effective, nil
+}
+
+// ApproveQuarantinedRate applies a pending rate to every country using its
+// currency, recomputes their estimated GDP and regenerates the summary image
+func (s *CountryService) ApproveQuarantinedRate(ctx context.Context, id int64) (*models.RateQuarantine, error) {
+	var entry *models.RateQuarantine
+	err := s.repo.WithTx(ctx, func(tx *database.Repository) error {
+		q, err := pendingQuarantine(tx, id)
+		if err != nil {
+			return err
+		}
+
+		countries, err := tx.GetCountriesByCurrency(q.CurrencyCode)
+		if err != nil {
+			return err
+		}
+
+		rates := map[string]float64{q.CurrencyCode: q.NewRate}
+		for i := range countries {
+			s.applyRate(&countries[i], rates)
+		}
+
+		now := time.Now()
+		if err := tx.UpdateCountryRates(countries, s.settings.BatchSize, now); err != nil {
+			return err
+		}
+		if err := tx.ResolveQuarantine(id, models.QuarantineApproved, now); err != nil {
+			return err
+		}
+
+		q.Status = models.QuarantineApproved
+		q.ResolvedAt = &now
+		entry = q
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Not tied to a refresh run, so the history is left alone
+	if err := s.imgService.GenerateSummaryImage(0); err != nil {
+		fmt.Printf("Warning: failed to generate summary image: %v\n", err)
+	}
+
+	return entry, nil
+}
+
+// RejectQuarantinedRate discards a pending rate, keeping the stored one
+func (s *CountryService) RejectQuarantinedRate(ctx context.Context, id int64) (*models.RateQuarantine, error) {
+	var entry *models.RateQuarantine
+	err := s.repo.WithTx(ctx, func(tx *database.Repository) error {
+		q, err := pendingQuarantine(tx, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.ResolveQuarantine(id, models.QuarantineRejected, now); err != nil {
+			return err
+		}
+
+		q.Status = models.QuarantineRejected
+		q.ResolvedAt = &now
+		entry = q
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func pendingQuarantine(tx *database.Repository, id int64) (*models.RateQuarantine, error) {
+	q, err := tx.GetQuarantinedRate(id)
+	if err != nil {
+		return nil, err
+	}
+	if q == nil {
+		return nil, ErrQuarantineNotFound
+	}
+	if q.Status != models.QuarantinePending {
+		return nil, fmt.Errorf("%w: %s", ErrQuarantineResolved, q.Status)
+	}
+	return q, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"countryCurrency/internal/models"
+)
+
+func TestHoldAnomalies(t *testing.T) {
+	stored := map[string]float64{"EUR": 0.9, "NGN": 1600, "XYZ": 12.5, "ZZZ": 0}
+	rates := map[string]float64{"EUR": 0.92, "NGN": 2400, "XYZ": 1250, "ZZZ": 5, "USD": 1}
+
+	tests := []struct {
+		name      string
+		threshold float64
+		held      []string
+	}{
+		{"disabled", 0, nil},
+		{"at 50%", 50, []string{"XYZ"}},
+		{"change equal to the threshold passes", 9900, nil},
+		{"at 10%", 10, []string{"NGN", "XYZ"}},
+		{"at 1%", 1, []string{"EUR", "NGN", "XYZ"}},
+	}
+
+	now := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effective, held := holdAnomalies(rates, stored, tt.threshold, now)
+
+			var codes []string
+			for _, entry := range held {
+				codes = append(codes, entry.CurrencyCode)
+				if entry.Status != models.QuarantinePending {
+					t.Errorf("%s status = %q, want pending", entry.CurrencyCode, entry.Status)
+				}
+				if effective[entry.CurrencyCode] != stored[entry.CurrencyCode] {
+					t.Errorf("%s effective rate = %g, want the stored %g", entry.CurrencyCode, effective[entry.CurrencyCode], stored[entry.CurrencyCode])
+				}
+			}
+			if !slices.Equal(codes, tt.held) {
+				t.Errorf("held = %q, want %q", codes, tt.held)
+			}
+
+			// Rates without a usable stored value always pass
+			if effective["USD"] != 1 || effective["ZZZ"] != 5 {
+				t.Errorf("effective = %v, want USD and ZZZ applied", effective)
+			}
+		})
+	}
+}
+
+func TestHoldAnomaliesReportsChange(t *testing.T) {
+	_, held := holdAnomalies(map[string]float64{"XYZ": 1250}, map[string]float64{"XYZ": 12.5}, 50, time.Now())
+	if len(held) != 1 {
+		t.Fatalf("held = %v, want one entry", held)
+	}
+	if entry := held[0]; entry.OldRate != 12.5 || entry.NewRate != 1250 || entry.ChangePct != 9900 {
+		t.Errorf("entry = %+v, want 12.5 → 1250 (9900%%)", entry)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+)
+
+// refreshRates fetches only the exchange rates and recomputes exchange_rate and
+// estimated_gdp of the stored countries. Country metadata is left untouched.
+func (s *CountryService) refreshRates(ctx context.Context, opts RefreshOptions, run *models.RefreshRun) error {
+	var rates map[string]float64
+	var result FetchResult
+	fetch, err := timeFetch("exchange_rates", func() (bool, error) {
+		var err error
+		rates, result, err = s.apiClient.FetchExchangeRates(ctx, opts.fetchMode())
+		return result.Changed, err
+	})
+	run.Sources = append(run.Sources, fetch)
+	if err != nil {
+		return fmt.Errorf("could not fetch data from exchange rate API: %w", err)
+	}
+
+	if rates, err = s.validateRates(rates, run); err != nil {
+		return err
+	}
+
+	progress := models.RefreshProgress{Stage: models.StageUpserting}
+
+	if !result.Changed {
+		fmt.Println("Exchange rates unchanged, skipping rate update")
+		if err := s.repo.UpdateLastRefreshedAt(); err != nil {
+			return fmt.Errorf("failed to update refresh timestamp: %w", err)
+		}
+		run.Outcome = models.OutcomeUnchanged
+	} else {
+		err := s.repo.WithTx(ctx, func(tx *database.Repository) error {
+			rates, err := s.quarantineRates(tx, rates, run)
+			if err != nil {
+				return err
+			}
+
+			countries, err := tx.GetAllCountries("", "", "", true)
+			if err != nil {
+				return err
+			}
+
+			progress.Fetched = len(countries)
+			progress.Total = len(countries)
+			opts.report(progress)
+
+			for i := range countries {
+				oldRate := countries[i].ExchangeRate
+				s.applyRate(&countries[i], rates)
+				if sameRate(oldRate, countries[i].ExchangeRate) {
+					run.Unchanged++
+				} else {
+					run.Updated++
+				}
+			}
+
+			if err := tx.UpdateCountryRates(countries, s.settings.BatchSize, time.Now()); err != nil {
+				return err
+			}
+			progress.Upserted = len(countries)
+			opts.report(progress)
+
+			if err := tx.UpdateLastRefreshedAt(); err != nil {
+				return fmt.Errorf("failed to update refresh timestamp: %w", err)
+			}
+			return saveValidators(tx, result.Validator)
+		})
+		if err != nil {
+			run.Updated, run.Unchanged = 0, 0
+			return err
+		}
+	}
+
+	if run.Outcome != models.OutcomeUnchanged {
+		s.recordSnapshot(run)
+	}
+	s.finishImage(opts, run, progress)
+
+	return nil
+}
+
+func sameRate(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
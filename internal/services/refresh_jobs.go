@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"countryCurrency/internal/database"
+	"countryCurrency/internal/models"
+)
+
+// refreshLeaseName is the MySQL lock that lets only one replica refresh at a time
+const refreshLeaseName = "country_refresh"
+
+// ErrRefreshBusy reports that a refresh of a different scope is already in flight in this process
+var ErrRefreshBusy = errors.New("a different refresh is already running")
+
+// ErrRefreshRunningElsewhere reports that another instance holds the refresh lease
+var ErrRefreshRunningElsewhere = errors.New("a refresh is already running on another instance")
+
+// RefreshJobs runs refreshes in the background and keeps the most recent
+// jobs in memory so clients can poll their progress.
+// Only one refresh runs at a time: callers arriving mid-run share the
+// in-flight job, and replicas coordinate through a MySQL lease.
+type RefreshJobs struct {
+	service refresher
+	leases  leaser
+	retain  int
+
+	mu      sync.Mutex
+	jobs    map[string]*refreshJob
+	order   []string
+	current *refreshJob
+}
+
+// refresher runs one refresh; *CountryService satisfies it
+type refresher interface {
+	RefreshCountries(ctx context.Context, opts RefreshOptions) (*models.RefreshRun, error)
+}
+
+// leaser takes a named lease, returning nil when another instance holds it
+type leaser interface {
+	AcquireLease(ctx context.Context, name string) (refreshLease, error)
+}
+
+// refreshLease is a lease held for the length of a refresh
+type refreshLease interface {
+	Release() error
+}
+
+// repositoryLeases takes leases from the database
+type repositoryLeases struct {
+	repo *database.Repository
+}
+
+func (r repositoryLeases) AcquireLease(ctx context.Context, name string) (refreshLease, error) {
+	lease, err := r.repo.AcquireLease(ctx, name)
+	if err != nil || lease == nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+type refreshJob struct {
+	opts RefreshOptions
+	job  models.RefreshJob
+	err  error
+	done chan struct{}
+
+	// reserving is set while Start acquires the lease outside the mutex, and
+	// for the whole of an Exclusive call; ready is closed once the job is
+	// published or the reservation dropped
+	reserving bool
+	ready     chan struct{}
+}
+
+func NewRefreshJobs(service *CountryService, repo *database.Repository, retain int) *RefreshJobs {
+	return &RefreshJobs{
+		service: service,
+		leases:  repositoryLeases{repo: repo},
+		retain:  retain,
+		jobs:    make(map[string]*refreshJob),
+	}
+}
+
+// Start launches a refresh detached from the caller's request and returns a
+// snapshot of its job. If a refresh that covers opts is already in flight in
+// this process, that job is returned instead of starting a new one; any other
+// in-flight refresh is returned with ErrRefreshBusy. If another instance holds
+// the refresh lease, ErrRefreshRunningElsewhere is returned.
+//
+// The lease is acquired without holding the mutex, so polling is not blocked
+// behind a slow GET_LOCK. The slot is reserved first; callers arriving in the
+// meantime wait for the reservation to be published or dropped.
+func (j *RefreshJobs) Start(ctx context.Context, opts RefreshOptions) (models.RefreshJob, error) {
+	if opts.Scope == "" {
+		opts.Scope = models.ScopeAll
+	}
+
+	j.mu.Lock()
+	if err := j.awaitReservationLocked(ctx); err != nil {
+		j.mu.Unlock()
+		return models.RefreshJob{}, err
+	}
+
+	if j.current != nil {
+		defer j.mu.Unlock()
+		if j.current.opts.covers(opts) {
+			return j.current.job, nil
+		}
+		return j.current.job, ErrRefreshBusy
+	}
+
+	entry := &refreshJob{
+		opts: opts,
+		job: models.RefreshJob{
+			ID:        newJobID(),
+			Scope:     opts.Scope,
+			Target:    opts.Target,
+			Status:    models.JobRunning,
+			CreatedAt: time.Now(),
+			Progress:  models.RefreshProgress{Stage: models.StageFetching},
+		},
+		done: make(chan struct{}),
+
+		reserving: true,
+		ready:     make(chan struct{}),
+	}
+	j.current = entry
+	j.mu.Unlock()
+
+	lease, err := j.leases.AcquireLease(ctx, refreshLeaseName)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	defer close(entry.ready)
+
+	if err != nil || lease == nil {
+		j.current = nil
+		if err != nil {
+			return models.RefreshJob{}, fmt.Errorf("failed to acquire refresh lease: %w", err)
+		}
+		return models.RefreshJob{}, ErrRefreshRunningElsewhere
+	}
+
+	entry.reserving = false
+	j.jobs[entry.job.ID] = entry
+	j.order = append(j.order, entry.job.ID)
+	j.evictLocked()
+
+	opts.Progress = func(p models.RefreshProgress) {
+		j.mu.Lock()
+		entry.job.Progress = p
+		j.mu.Unlock()
+	}
+
+	go j.run(entry, opts, lease)
+
+	return entry.job, nil
+}
+
+// Exclusive runs fn in the refresh slot, holding the refresh lease, for
+// changes to stored rates that must not interleave with a refresh. While a
+// refresh is in flight in this process it returns ErrRefreshBusy, and while
+// another instance holds the lease ErrRefreshRunningElsewhere; fn is not run.
+// A refresh started during fn waits for it to finish.
+func (j *RefreshJobs) Exclusive(ctx context.Context, fn func() error) error {
+	j.mu.Lock()
+	if err := j.awaitReservationLocked(ctx); err != nil {
+		j.mu.Unlock()
+		return err
+	}
+	if j.current != nil {
+		j.mu.Unlock()
+		return ErrRefreshBusy
+	}
+
+	entry := &refreshJob{reserving: true, ready: make(chan struct{})}
+	j.current = entry
+	j.mu.Unlock()
+
+	defer func() {
+		j.mu.Lock()
+		j.current = nil
+		close(entry.ready)
+		j.mu.Unlock()
+	}()
+
+	lease, err := j.leases.AcquireLease(ctx, refreshLeaseName)
+	if err != nil {
+		return fmt.Errorf("failed to acquire refresh lease: %w", err)
+	}
+	if lease == nil {
+		return ErrRefreshRunningElsewhere
+	}
+	defer func() {
+		if err := lease.Release(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}()
+
+	return fn()
+}
+
+// awaitReservationLocked waits, with the mutex held on entry and on return,
+// until no reservation occupies the slot
+func (j *RefreshJobs) awaitReservationLocked(ctx context.Context) error {
+	for j.current != nil && j.current.reserving {
+		ready := j.current.ready
+		j.mu.Unlock()
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			j.mu.Lock()
+			return ctx.Err()
+		}
+		j.mu.Lock()
+	}
+	return nil
+}
+
+// Running reports whether a refresh is in flight in this process
+func (j *RefreshJobs) Running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.current != nil && !j.current.reserving
+}
+
+func (j *RefreshJobs) run(entry *refreshJob, opts RefreshOptions, lease refreshLease) {
+	run, err := j.service.RefreshCountries(context.Background(), opts)
+
+	if err := lease.Release(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	j.mu.Lock()
+	j.current = nil
+	finished := time.Now()
+	entry.job.FinishedAt = &finished
+	entry.job.Result = run
+	entry.err = err
+	if err != nil {
+		entry.job.Status = models.JobFailed
+		entry.job.Error = err.Error()
+	} else {
+		entry.job.Status = models.JobSucceeded
+	}
+	j.mu.Unlock()
+
+	close(entry.done)
+}
+
+// Get returns a snapshot of the job with the given ID
+func (j *RefreshJobs) Get(id string) (models.RefreshJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.jobs[id]
+	if !ok {
+		return models.RefreshJob{}, false
+	}
+	return entry.job, true
+}
+
+// Wait blocks until the job finishes or ctx is done. It returns the final
+// snapshot and the error the refresh itself returned.
+func (j *RefreshJobs) Wait(ctx context.Context, id string) (models.RefreshJob, error) {
+	j.mu.Lock()
+	entry, ok := j.jobs[id]
+	j.mu.Unlock()
+	if !ok {
+		return models.RefreshJob{}, nil
+	}
+
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		job, _ := j.Get(id)
+		return job, ctx.Err()
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return entry.job, entry.err
+}
+
+// evictLocked drops the oldest finished jobs beyond the retention limit
+func (j *RefreshJobs) evictLocked() {
+	for i := 0; len(j.order) > j.retain && i < len(j.order); {
+		id := j.order[i]
+		if j.jobs[id].job.Status == models.JobRunning {
+			i++
+			continue
+		}
+		delete(j.jobs, id)
+		j.order = append(j.order[:i], j.order[i+1:]...)
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
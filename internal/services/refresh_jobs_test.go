@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"countryCurrency/internal/models"
+)
+
+// fakeLeases hands out leases after gate is closed; held makes every
+// acquisition report a lease taken by another instance
+type fakeLeases struct {
+	gate chan struct{}
+	held bool
+	err  error
+
+	mu       sync.Mutex
+	acquired int
+	released int
+}
+
+func newFakeLeases() *fakeLeases {
+	gate := make(chan struct{})
+	close(gate)
+	return &fakeLeases{gate: gate}
+}
+
+func (f *fakeLeases) AcquireLease(ctx context.Context, name string) (refreshLease, error) {
+	<-f.gate
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.held {
+		return nil, nil
+	}
+	f.mu.Lock()
+	f.acquired++
+	f.mu.Unlock()
+	return f, nil
+}
+
+func (f *fakeLeases) Release() error {
+	f.mu.Lock()
+	f.released++
+	f.mu.Unlock()
+	return nil
+}
+
+// blockingRefresher runs refreshes that finish when release is closed
+type blockingRefresher struct {
+	release chan struct{}
+}
+
+func (r blockingRefresher) RefreshCountries(ctx context.Context, opts RefreshOptions) (*models.RefreshRun, error) {
+	<-r.release
+	return &models.RefreshRun{}, nil
+}
+
+func newTestRefreshJobs(leases *fakeLeases) (*RefreshJobs, chan struct{}) {
+	release := make(chan struct{})
+	jobs := &RefreshJobs{
+		service: blockingRefresher{release: release},
+		leases:  leases,
+		retain:  10,
+		jobs:    make(map[string]*refreshJob),
+	}
+	return jobs, release
+}
+
+func TestRefreshJobsConcurrentStartsAreBusy(t *testing.T) {
+	leases := newFakeLeases()
+	leases.gate = make(chan struct{})
+	jobs, release := newTestRefreshJobs(leases)
+	defer close(release)
+
+	targets := []string{"France", "Japan"}
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = jobs.Start(context.Background(), RefreshOptions{Scope: models.ScopeCountry, Target: target})
+		}()
+	}
+	// The later start either waits on the reservation or finds the published job
+	close(leases.gate)
+	wg.Wait()
+
+	var started, busy int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			started++
+		case errors.Is(err, ErrRefreshBusy):
+			busy++
+		default:
+			t.Errorf("Start() error = %v", err)
+		}
+	}
+	if started != 1 || busy != 1 {
+		t.Errorf("Start() started %d and reported %d busy, want 1 and 1", started, busy)
+	}
+	if leases.acquired != 1 {
+		t.Errorf("lease acquired %d times, want 1", leases.acquired)
+	}
+	if !jobs.Running() {
+		t.Error("Running() = false while a refresh is in flight")
+	}
+}
+
+func TestRefreshJobsLeaseHeldElsewhere(t *testing.T) {
+	leases := newFakeLeases()
+	leases.held = true
+	jobs, release := newTestRefreshJobs(leases)
+	defer close(release)
+
+	if _, err := jobs.Start(context.Background(), RefreshOptions{}); !errors.Is(err, ErrRefreshRunningElsewhere) {
+		t.Fatalf("Start() error = %v, want ErrRefreshRunningElsewhere", err)
+	}
+	if jobs.Running() {
+		t.Error("Running() = true after the lease was refused")
+	}
+}
+
+func TestRefreshJobsReleasesReservationOnLeaseError(t *testing.T) {
+	leases := newFakeLeases()
+	leases.err = errors.New("connection refused")
+	jobs, release := newTestRefreshJobs(leases)
+	close(release)
+
+	if _, err := jobs.Start(context.Background(), RefreshOptions{}); err == nil || !errors.Is(err, leases.err) {
+		t.Fatalf("Start() error = %v, want the lease error", err)
+	}
+
+	// The slot is free again, so the next start acquires its own lease
+	leases.err = nil
+	job, err := jobs.Start(context.Background(), RefreshOptions{})
+	if err != nil {
+		t.Fatalf("Start() after a failed lease: %v", err)
+	}
+	if _, err := jobs.Wait(context.Background(), job.ID); err != nil {
+		t.Fatalf("Wait(): %v", err)
+	}
+	if leases.acquired != 1 || leases.released != 1 {
+		t.Errorf("lease acquired %d and released %d times, want 1 and 1", leases.acquired, leases.released)
+	}
+}
+
+func TestRefreshJobsExclusive(t *testing.T) {
+	leases := newFakeLeases()
+	jobs, release := newTestRefreshJobs(leases)
+
+	job, err := jobs.Start(context.Background(), RefreshOptions{})
+	if err != nil {
+		t.Fatalf("Start(): %v", err)
+	}
+
+	ran := false
+	err = jobs.Exclusive(context.Background(), func() error {
+		ran = true
+		return nil
+	})
+	if !errors.Is(err, ErrRefreshBusy) || ran {
+		t.Fatalf("Exclusive() during a refresh = %v (ran %v), want ErrRefreshBusy without running", err, ran)
+	}
+
+	close(release)
+	if _, err := jobs.Wait(context.Background(), job.ID); err != nil {
+		t.Fatalf("Wait(): %v", err)
+	}
+
+	want := errors.New("rate update failed")
+	err = jobs.Exclusive(context.Background(), func() error {
+		ran = true
+		if jobs.Running() {
+			t.Error("Running() = true inside Exclusive")
+		}
+		return want
+	})
+	if err != want || !ran {
+		t.Fatalf("Exclusive() = %v (ran %v), want the error of fn", err, ran)
+	}
+	if leases.acquired != 2 || leases.released != 2 {
+		t.Errorf("lease acquired %d and released %d times, want 2 and 2", leases.acquired, leases.released)
+	}
+
+	// The slot is free again once Exclusive returns
+	if _, err := jobs.Start(context.Background(), RefreshOptions{}); err != nil {
+		t.Errorf("Start() after Exclusive: %v", err)
+	}
+}
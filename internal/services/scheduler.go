@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"countryCurrency/internal/database"
+)
+
+const (
+	// schedulerLeaseName is the MySQL lock held by the replica running scheduled refreshes
+	schedulerLeaseName = "country_refresh_scheduler"
+
+	leaderRetryInterval = 30 * time.Second
+	leaderCheckInterval = 15 * time.Second
+)
+
+// ScheduleEntry is a cron schedule and the refresh it triggers
+type ScheduleEntry struct {
+	Name     string
+	Schedule cron.Schedule
+	Options  RefreshOptions
+}
+
+// ParseSchedule parses a standard five-field cron expression or a descriptor such as @daily
+func ParseSchedule(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// Scheduler triggers refreshes on cron schedules. Only the replica holding the
+// scheduler lease fires ticks. A tick is skipped when a refresh is still running.
+type Scheduler struct {
+	jobs    *RefreshJobs
+	repo    *database.Repository
+	entries []ScheduleEntry
+	jitter  time.Duration
+}
+
+func NewScheduler(jobs *RefreshJobs, repo *database.Repository, entries []ScheduleEntry, jitter time.Duration) *Scheduler {
+	return &Scheduler{
+		jobs:    jobs,
+		repo:    repo,
+		entries: entries,
+		jitter:  jitter,
+	}
+}
+
+// Run blocks until ctx is done, alternating between waiting for leadership
+// and firing schedules while this instance is the leader
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.entries) == 0 {
+		return
+	}
+
+	for {
+		lease, err := s.repo.AcquireLease(ctx, schedulerLeaseName)
+		if err != nil {
+			fmt.Printf("Warning: scheduler election failed: %v\n", err)
+		}
+
+		if lease != nil {
+			fmt.Println("Scheduler: this instance is the leader")
+			s.lead(ctx, lease)
+			if err := lease.Release(); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(leaderRetryInterval):
+		}
+	}
+}
+
+// lead fires all schedules until ctx is done or the lease is lost
+func (s *Scheduler) lead(ctx context.Context, lease *database.Lease) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, entry := range s.entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runEntry(leaderCtx, entry)
+		}()
+	}
+
+	ticker := time.NewTicker(leaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			wg.Wait()
+			return
+		case <-ticker.C:
+			if err := lease.Alive(ctx); err != nil {
+				fmt.Printf("Warning: scheduler lost leadership: %v\n", err)
+				cancel()
+				wg.Wait()
+				return
+			}
+		}
+	}
+}
+
+func (s *Scheduler) runEntry(ctx context.Context, entry ScheduleEntry) {
+	for {
+		next := entry.Schedule.Next(time.Now())
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.fire(ctx, entry)
+	}
+}
+
+func (s *Scheduler) fire(ctx context.Context, entry ScheduleEntry) {
+	if s.jobs.Running() {
+		fmt.Printf("Scheduler: skipping %s refresh, previous run still in progress\n", entry.Name)
+		return
+	}
+
+	job, err := s.jobs.Start(ctx, entry.Options)
+	if errors.Is(err, ErrRefreshRunningElsewhere) {
+		fmt.Printf("Scheduler: skipping %s refresh, %v\n", entry.Name, err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("Warning: scheduled %s refresh failed to start: %v\n", entry.Name, err)
+		return
+	}
+
+	fmt.Printf("Scheduler: started %s refresh job %s\n", entry.Name, job.ID)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2025, 10, 22, 18, 7, 0, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"0 * * * *", time.Date(2025, 10, 22, 19, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 10, 22, 18, 15, 0, 0, time.UTC)},
+		{"0 3 * * 1", time.Date(2025, 10, 27, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 10, 23, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2025, 10, 22, 19, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(tt.next) {
+			t.Errorf("ParseSchedule(%q).Next() = %v, want %v", tt.expr, got, tt.next)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * *", "61 * * * *", "0 0 * * * *", "@fortnightly"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", expr)
+		}
+	}
+}
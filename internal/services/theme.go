@@ -0,0 +1,342 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Built-in theme names
+const (
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+// chartMargins are the blank space around a chart, in units of the 600x400
+// layout, so they scale with the image
+type chartMargins struct {
+	Top, Right, Bottom, Left float64
+}
+
+// chartLogo is a PNG drawn in the top right corner. The encoded bytes are
+// kept for SVG output, which embeds them.
+type chartLogo struct {
+	img image.Image
+	png []byte
+}
+
+// chartTheme is how a chart is colored and laid out
+type chartTheme struct {
+	background  color.RGBA
+	text        color.RGBA
+	mutedText   color.RGBA
+	gridline    color.RGBA
+	axis        color.RGBA
+	regions     map[string]color.RGBA
+	otherRegion color.RGBA
+
+	// title replaces the chart title; {title} expands to the generated one
+	title   string
+	logo    *chartLogo
+	margins chartMargins
+}
+
+var defaultMargins = chartMargins{Top: 20, Right: 20, Bottom: 12, Left: 20}
+
+var lightTheme = chartTheme{
+	background: color.RGBA{255, 255, 255, 255},
+	text:       color.RGBA{33, 37, 41, 255},
+	mutedText:  color.RGBA{108, 117, 125, 255},
+	gridline:   color.RGBA{222, 226, 230, 255},
+	axis:       color.RGBA{173, 181, 189, 255},
+	regions: map[string]color.RGBA{
+		"Africa":    {228, 87, 46, 255},
+		"Americas":  {41, 128, 185, 255},
+		"Asia":      {243, 156, 18, 255},
+		"Europe":    {39, 174, 96, 255},
+		"Oceania":   {142, 68, 173, 255},
+		"Polar":     {22, 160, 133, 255},
+		"Antarctic": {22, 160, 133, 255},
+	},
+	otherRegion: color.RGBA{149, 165, 166, 255},
+	margins:     defaultMargins,
+}
+
+var darkTheme = chartTheme{
+	background: color.RGBA{24, 26, 31, 255},
+	text:       color.RGBA{233, 236, 239, 255},
+	mutedText:  color.RGBA{173, 181, 189, 255},
+	gridline:   color.RGBA{52, 58, 64, 255},
+	axis:       color.RGBA{108, 117, 125, 255},
+	regions: map[string]color.RGBA{
+		"Africa":    {240, 113, 76, 255},
+		"Americas":  {77, 163, 222, 255},
+		"Asia":      {247, 183, 64, 255},
+		"Europe":    {72, 201, 128, 255},
+		"Oceania":   {175, 122, 197, 255},
+		"Polar":     {64, 196, 170, 255},
+		"Antarctic": {64, 196, 170, 255},
+	},
+	otherRegion: color.RGBA{160, 170, 180, 255},
+	margins:     defaultMargins,
+}
+
+func (t *chartTheme) regionColor(region string) color.RGBA {
+	if c, ok := t.regions[region]; ok {
+		return c
+	}
+	return t.otherRegion
+}
+
+func (t *chartTheme) titleFor(generated string) string {
+	if t.title == "" {
+		return generated
+	}
+	return strings.ReplaceAll(t.title, "{title}", generated)
+}
+
+// themeConfig is a theme as written in the themes file. Empty fields keep
+// the value of the theme it extends.
+type themeConfig struct {
+	Extends     string            `yaml:"extends" json:"extends"`
+	Background  string            `yaml:"background" json:"background"`
+	Text        string            `yaml:"text" json:"text"`
+	MutedText   string            `yaml:"muted_text" json:"muted_text"`
+	Gridline    string            `yaml:"gridline" json:"gridline"`
+	Axis        string            `yaml:"axis" json:"axis"`
+	Palette     map[string]string `yaml:"palette" json:"palette"`
+	OtherRegion string            `yaml:"other_region" json:"other_region"`
+	Title       string            `yaml:"title" json:"title"`
+	Logo        string            `yaml:"logo" json:"logo"`
+	Margins     *struct {
+		Top    *float64 `yaml:"top" json:"top"`
+		Right  *float64 `yaml:"right" json:"right"`
+		Bottom *float64 `yaml:"bottom" json:"bottom"`
+		Left   *float64 `yaml:"left" json:"left"`
+	} `yaml:"margins" json:"margins"`
+}
+
+// loadThemes returns the built-in themes plus those defined in the file at
+// path, which is JSON when it ends in .json and YAML otherwise. A file theme
+// named light or dark replaces the built-in one; unless it names another
+// theme to extend, it starts from the built-in of the same name.
+func loadThemes(path string) (map[string]*chartTheme, error) {
+	light, dark := lightTheme, darkTheme
+	builtin := map[string]*chartTheme{ThemeLight: &light, ThemeDark: &dark}
+	if path == "" {
+		return builtin, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read themes file: %w", err)
+	}
+
+	var file struct {
+		Themes map[string]themeConfig `yaml:"themes" json:"themes"`
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &file)
+	} else {
+		err = yaml.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse themes file: %w", err)
+	}
+
+	// Sorted, so errors are reported in a stable order
+	names := make([]string, 0, len(file.Themes))
+	for name := range file.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	themes := map[string]*chartTheme{}
+	building := map[string]bool{}
+	var build func(name string) (*chartTheme, error)
+	build = func(name string) (*chartTheme, error) {
+		if theme, ok := themes[name]; ok {
+			return theme, nil
+		}
+		cfg, ok := file.Themes[name]
+		if !ok {
+			themes[name] = builtin[name]
+			return builtin[name], nil
+		}
+		if building[name] {
+			return nil, fmt.Errorf("theme %q is part of an extends cycle", name)
+		}
+		building[name] = true
+
+		extends := cfg.Extends
+		if extends == "" {
+			extends = ThemeLight
+			if _, ok := builtin[name]; ok {
+				extends = name
+			}
+		}
+		if _, ok := builtin[extends]; !ok {
+			if _, ok := file.Themes[extends]; !ok {
+				return nil, fmt.Errorf("theme %q extends unknown theme %q", name, extends)
+			}
+		}
+
+		// A replaced built-in extending its own name starts from the original
+		var base *chartTheme
+		if extends == name && builtin[name] != nil {
+			base = builtin[name]
+		} else {
+			var err error
+			if base, err = build(extends); err != nil {
+				return nil, err
+			}
+		}
+
+		theme, err := buildTheme(base, cfg, filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("theme %q: %w", name, err)
+		}
+		themes[name] = theme
+		return theme, nil
+	}
+
+	for _, name := range names {
+		if _, err := build(name); err != nil {
+			return nil, err
+		}
+	}
+	for name, theme := range builtin {
+		if _, ok := themes[name]; !ok {
+			themes[name] = theme
+		}
+	}
+
+	return themes, nil
+}
+
+// buildTheme overlays cfg on base. Relative logo paths are resolved against dir.
+func buildTheme(base *chartTheme, cfg themeConfig, dir string) (*chartTheme, error) {
+	theme := *base
+	theme.regions = make(map[string]color.RGBA, len(base.regions))
+	for region, c := range base.regions {
+		theme.regions[region] = c
+	}
+
+	colors := []struct {
+		field string
+		value string
+		dest  *color.RGBA
+	}{
+		{"background", cfg.Background, &theme.background},
+		{"text", cfg.Text, &theme.text},
+		{"muted_text", cfg.MutedText, &theme.mutedText},
+		{"gridline", cfg.Gridline, &theme.gridline},
+		{"axis", cfg.Axis, &theme.axis},
+		{"other_region", cfg.OtherRegion, &theme.otherRegion},
+	}
+	for _, c := range colors {
+		if c.value == "" {
+			continue
+		}
+		parsed, err := parseHexColor(c.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.field, err)
+		}
+		*c.dest = parsed
+	}
+
+	for region, value := range cfg.Palette {
+		parsed, err := parseHexColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("palette %s: %w", region, err)
+		}
+		theme.regions[region] = parsed
+	}
+
+	if cfg.Title != "" {
+		theme.title = cfg.Title
+	}
+
+	if cfg.Margins != nil {
+		margins := []struct {
+			field string
+			value *float64
+			dest  *float64
+		}{
+			{"top", cfg.Margins.Top, &theme.margins.Top},
+			{"right", cfg.Margins.Right, &theme.margins.Right},
+			{"bottom", cfg.Margins.Bottom, &theme.margins.Bottom},
+			{"left", cfg.Margins.Left, &theme.margins.Left},
+		}
+		for _, m := range margins {
+			if m.value == nil {
+				continue
+			}
+			if *m.value < 0 || *m.value > 100 {
+				return nil, fmt.Errorf("margins %s must be between 0 and 100", m.field)
+			}
+			*m.dest = *m.value
+		}
+	}
+
+	if cfg.Logo != "" {
+		path := cfg.Logo
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		logo, err := loadLogo(path)
+		if err != nil {
+			return nil, err
+		}
+		theme.logo = logo
+	}
+
+	return &theme, nil
+}
+
+func loadLogo(path string) (*chartLogo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo, it must be a PNG: %w", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil, fmt.Errorf("logo is empty")
+	}
+
+	return &chartLogo{img: img, png: data}, nil
+}
+
+// parseHexColor parses #rgb, #rrggbb or #rrggbbaa
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb or #rrggbbaa", s)
+	}
+
+	// Canvases expect premultiplied alpha
+	nrgba := color.NRGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}
+	return color.RGBAModel.Convert(nrgba).(color.RGBA), nil
+}
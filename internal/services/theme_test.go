@@ -0,0 +1,98 @@
+package services
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeThemes(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "themes.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadThemesReplacesBuiltIns(t *testing.T) {
+	path := writeThemes(t, `
+themes:
+  dark:
+    background: "#000000"
+  brand:
+    extends: dark
+    text: "#ffffff"
+  light:
+    extends: brand
+`)
+
+	themes, err := loadThemes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	black := color.RGBA{0, 0, 0, 255}
+
+	// dark without extends starts from the built-in dark
+	dark := themes[ThemeDark]
+	if dark.background != black {
+		t.Errorf("dark background = %v, want %v", dark.background, black)
+	}
+	if dark.mutedText != darkTheme.mutedText {
+		t.Errorf("dark muted text = %v, want the built-in %v", dark.mutedText, darkTheme.mutedText)
+	}
+
+	// Other themes extending dark get the replaced one
+	if brand := themes["brand"]; brand.background != black {
+		t.Errorf("brand background = %v, want %v from the replaced dark", brand.background, black)
+	}
+
+	// light may extend any theme instead of the built-in light
+	light := themes[ThemeLight]
+	if light.background != black || light.text != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("light = %v on %v, want the brand colors", light.text, light.background)
+	}
+
+	if lightTheme.background != (color.RGBA{255, 255, 255, 255}) || darkTheme.background == black {
+		t.Error("loadThemes modified the built-in themes")
+	}
+}
+
+func TestLoadThemesKeepsUnreplacedBuiltIns(t *testing.T) {
+	path := writeThemes(t, `
+themes:
+  light:
+    title: "Acme — {title}"
+`)
+
+	themes, err := loadThemes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := themes[ThemeLight].titleFor("Top 10"); got != "Acme — Top 10" {
+		t.Errorf("light title = %q, want %q", got, "Acme — Top 10")
+	}
+	if themes[ThemeLight].background != lightTheme.background {
+		t.Errorf("light background = %v, want the built-in %v", themes[ThemeLight].background, lightTheme.background)
+	}
+	if themes[ThemeDark].background != darkTheme.background {
+		t.Errorf("dark background = %v, want the built-in %v", themes[ThemeDark].background, darkTheme.background)
+	}
+}
+
+func TestLoadThemesRejectsCycles(t *testing.T) {
+	path := writeThemes(t, `
+themes:
+  light:
+    extends: dark
+  dark:
+    extends: light
+`)
+
+	if _, err := loadThemes(path); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("loadThemes() error = %v, want an extends cycle", err)
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"countryCurrency/internal/models"
+)
+
+// Longest country name the countries table can hold
+const maxNameLength = 255
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// validateCountry lists why apiCountry cannot be loaded, or nothing when it can
+func validateCountry(apiCountry models.CountryAPIResponse) []string {
+	var reasons []string
+
+	if strings.TrimSpace(apiCountry.Name) == "" {
+		reasons = append(reasons, "name is empty")
+	} else if utf8.RuneCountInString(apiCountry.Name) > maxNameLength {
+		reasons = append(reasons, fmt.Sprintf("name is longer than %d characters", maxNameLength))
+	}
+
+	if apiCountry.Population < 0 {
+		reasons = append(reasons, fmt.Sprintf("population %d is negative", apiCountry.Population))
+	}
+
+	if apiCountry.Flag != "" {
+		u, err := url.Parse(apiCountry.Flag)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			reasons = append(reasons, fmt.Sprintf("flag %q is not an absolute http(s) URL", apiCountry.Flag))
+		}
+	}
+
+	return reasons
+}
+
+// currencyProblem says why the currency of apiCountry cannot be stored, or
+// returns "" when it can. Such a country is still loaded, without a currency.
+func currencyProblem(apiCountry models.CountryAPIResponse, currencies *CurrencyRegistry) string {
+	// Only the first currency is stored, so only it has to be usable
+	if len(apiCountry.Currencies) == 0 || apiCountry.Currencies[0].Code == "" {
+		return ""
+	}
+
+	code := apiCountry.Currencies[0].Code
+	switch current, ok := currencies.Resolve(code); {
+	case !ok:
+		return fmt.Sprintf("currency code %q is not an ISO 4217 code", code)
+	case current.Withdrawn:
+		return fmt.Sprintf("currency code %q is withdrawn without a successor", code)
+	}
+	return ""
+}
+
+// validateRate lists why the published rate for code cannot be used
+func validateRate(code string, rate float64) []string {
+	var reasons []string
+
+	if !currencyCodePattern.MatchString(code) {
+		reasons = append(reasons, "currency code is not three uppercase letters")
+	}
+
+	switch {
+	case math.IsNaN(rate) || math.IsInf(rate, 0):
+		reasons = append(reasons, "rate is not a finite number")
+	case rate <= 0:
+		reasons = append(reasons, fmt.Sprintf("rate %g is not positive", rate))
+	}
+
+	return reasons
+}
+
+// validateUpstream drops invalid country records and rates from data, records
+// why on run, and aborts when more than MaxInvalidPct percent of either
+// source is invalid. Currency codes of the remaining records are normalized to
+// their current ISO 4217 code; a country whose currency is unusable is kept
+// without one, and listed on run as kept. Names of dropped countries are kept
+// in data.rejected so the missing-country policy does not treat them as gone.
+func (s *CountryService) validateUpstream(data *upstreamData, run *models.RefreshRun) error {
+	total := len(data.countries)
+	valid := make([]models.CountryAPIResponse, 0, total)
+	seen := make(map[string]bool, total)
+	var rejected, kept []models.Rejection
+
+	for i, apiCountry := range data.countries {
+		reasons := validateCountry(apiCountry)
+		problem := currencyProblem(apiCountry, s.currencies)
+
+		key := strings.ToLower(strings.TrimSpace(apiCountry.Name))
+		if key != "" && seen[key] {
+			reasons = append(reasons, "duplicate of an earlier record")
+		}
+
+		if len(reasons) == 0 {
+			seen[key] = true
+			if problem != "" {
+				apiCountry.Currencies = nil
+				kept = append(kept, models.Rejection{
+					Source:  "countries",
+					Record:  strings.TrimSpace(apiCountry.Name),
+					Reasons: []string{problem + ", stored without a currency"},
+					Kept:    true,
+				})
+			}
+			s.normalizeCurrency(&apiCountry)
+			valid = append(valid, apiCountry)
+			continue
+		}
+		if problem != "" {
+			reasons = append(reasons, problem)
+		}
+
+		record := strings.TrimSpace(apiCountry.Name)
+		if record == "" {
+			record = fmt.Sprintf("#%d", i)
+		} else {
+			data.rejected = append(data.rejected, record)
+		}
+		rejected = append(rejected, models.Rejection{Source: "countries", Record: record, Reasons: reasons})
+	}
+	data.countries = valid
+
+	run.Rejected = append(run.Rejected, rejected...)
+	run.Rejected = append(run.Rejected, kept...)
+	if err := s.checkInvalidShare("countries", len(rejected), total); err != nil {
+		return err
+	}
+
+	var err error
+	data.rates, err = s.validateRates(data.rates, run)
+	return err
+}
+
+// normalizeCurrency rewrites the stored currency code of apiCountry to its
+// canonical spelling, mapping withdrawn codes to their successor
+func (s *CountryService) normalizeCurrency(apiCountry *models.CountryAPIResponse) {
+	if len(apiCountry.Currencies) == 0 || apiCountry.Currencies[0].Code == "" {
+		return
+	}
+
+	code := apiCountry.Currencies[0].Code
+	current, ok := s.currencies.Resolve(code)
+	if !ok || current.Code == code {
+		return
+	}
+
+	if previous, _ := s.currencies.Lookup(code); previous.Withdrawn {
+		fmt.Printf("Mapped withdrawn currency %s of %s to %s\n", code, apiCountry.Name, current.Code)
+	}
+	apiCountry.Currencies[0].Code = current.Code
+}
+
+// validateRates returns the usable rates, recording the rejected ones on run.
+// Countries are stored with the successor of a withdrawn currency, so the rate
+// of a withdrawn code is also returned under its successor when the provider
+// publishes none for it.
+func (s *CountryService) validateRates(rates map[string]float64, run *models.RefreshRun) (map[string]float64, error) {
+	codes := make([]string, 0, len(rates))
+	for code := range rates {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	valid := make(map[string]float64, len(rates))
+	invalid := 0
+	for _, code := range codes {
+		reasons := validateRate(code, rates[code])
+		if len(reasons) == 0 {
+			valid[code] = rates[code]
+			continue
+		}
+
+		invalid++
+		run.Rejected = append(run.Rejected, models.Rejection{Source: "exchange_rates", Record: code, Reasons: reasons})
+	}
+
+	if err := s.checkInvalidShare("exchange rate", invalid, len(rates)); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		rate, ok := valid[code]
+		if !ok {
+			continue
+		}
+		current, ok := s.currencies.Resolve(code)
+		if !ok || current.Withdrawn || current.Code == code {
+			continue
+		}
+		if _, published := valid[current.Code]; !published {
+			valid[current.Code] = rate
+			fmt.Printf("Using the %s rate for its successor %s\n", code, current.Code)
+		}
+	}
+	return valid, nil
+}
+
+// checkInvalidShare aborts the refresh when invalid out of total records
+// exceeds MaxInvalidPct percent
+func (s *CountryService) checkInvalidShare(source string, invalid, total int) error {
+	if invalid == 0 || total == 0 {
+		return nil
+	}
+
+	pct := float64(invalid) * 100 / float64(total)
+	if pct <= s.settings.MaxInvalidPct {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d of %d %s records are invalid (%.1f%%, threshold %g%%)",
+		ErrRefreshAborted, invalid, total, source, pct, s.settings.MaxInvalidPct)
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"countryCurrency/internal/models"
+)
+
+// apiCurrency is the element type of CountryAPIResponse.Currencies
+type apiCurrency = struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Symbol string `json:"symbol"`
+}
+
+func withCurrency(code string) []apiCurrency {
+	return []apiCurrency{{Code: code}}
+}
+
+func TestValidateCountry(t *testing.T) {
+	tests := []struct {
+		name    string
+		country models.CountryAPIResponse
+		want    []string
+	}{
+		{
+			name:    "valid",
+			country: models.CountryAPIResponse{Name: "Nigeria", Population: 1, Flag: "https://flagcdn.com/ng.svg"},
+		},
+		{
+			name:    "no flag",
+			country: models.CountryAPIResponse{Name: "Nigeria"},
+		},
+		{
+			name:    "empty name",
+			country: models.CountryAPIResponse{Name: "  "},
+			want:    []string{"name is empty"},
+		},
+		{
+			name:    "long name",
+			country: models.CountryAPIResponse{Name: strings.Repeat("é", maxNameLength+1)},
+			want:    []string{"name is longer than 255 characters"},
+		},
+		{
+			name:    "negative population",
+			country: models.CountryAPIResponse{Name: "Atlantis", Population: -5},
+			want:    []string{"population -5 is negative"},
+		},
+		{
+			name:    "relative flag",
+			country: models.CountryAPIResponse{Name: "Atlantis", Flag: "/flags/at.svg"},
+			want:    []string{`flag "/flags/at.svg" is not an absolute http(s) URL`},
+		},
+		{
+			name:    "non-http flag",
+			country: models.CountryAPIResponse{Name: "Atlantis", Flag: "javascript:alert(1)"},
+			want:    []string{`flag "javascript:alert(1)" is not an absolute http(s) URL`},
+		},
+		{
+			name:    "unknown currency is not a reason to drop",
+			country: models.CountryAPIResponse{Name: "Atlantis", Currencies: withCurrency("ATL")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validateCountry(tt.country); !slices.Equal(got, tt.want) {
+				t.Errorf("validateCountry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencyProblem(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := []struct {
+		name       string
+		currencies []apiCurrency
+		want       string
+	}{
+		{"no currencies", nil, ""},
+		{"empty code", withCurrency(""), ""},
+		{"active", withCurrency("NGN"), ""},
+		{"withdrawn with successor", withCurrency("ZWL"), ""},
+		{"unknown", withCurrency("ATL"), `currency code "ATL" is not an ISO 4217 code`},
+		{"only the first counts", []apiCurrency{{Code: "USD"}, {Code: "ATL"}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			country := models.CountryAPIResponse{Name: "Test", Currencies: tt.currencies}
+			if got := currencyProblem(country, registry); got != tt.want {
+				t.Errorf("currencyProblem() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRate(t *testing.T) {
+	tests := []struct {
+		code string
+		rate float64
+		want []string
+	}{
+		{"USD", 1, nil},
+		{"usd", 1, []string{"currency code is not three uppercase letters"}},
+		{"US", 1, []string{"currency code is not three uppercase letters"}},
+		{"EUR", 0, []string{"rate 0 is not positive"}},
+		{"EUR", -2, []string{"rate -2 is not positive"}},
+		{"EUR", math.NaN(), []string{"rate is not a finite number"}},
+		{"EUR", math.Inf(1), []string{"rate is not a finite number"}},
+	}
+
+	for _, tt := range tests {
+		if got := validateRate(tt.code, tt.rate); !slices.Equal(got, tt.want) {
+			t.Errorf("validateRate(%q, %g) = %q, want %q", tt.code, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRates(t *testing.T) {
+	s := &CountryService{currencies: newTestRegistry(t), settings: RefreshSettings{MaxInvalidPct: 50}}
+
+	tests := []struct {
+		name  string
+		rates map[string]float64
+		want  map[string]float64
+	}{
+		{
+			name:  "successor published",
+			rates: map[string]float64{"EUR": 0.9, "HRK": 7.5},
+			want:  map[string]float64{"EUR": 0.9, "HRK": 7.5},
+		},
+		{
+			name:  "only the legacy code published",
+			rates: map[string]float64{"SLL": 22000, "ZWL": 322},
+			want:  map[string]float64{"SLL": 22000, "SLE": 22000, "ZWL": 322, "ZWG": 322},
+		},
+		{
+			name:  "invalid legacy rate is not carried over",
+			rates: map[string]float64{"USD": 1, "EUR": 0.9, "ZWL": -1},
+			want:  map[string]float64{"USD": 1, "EUR": 0.9},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.validateRates(tt.rates, &models.RefreshRun{})
+			if err != nil {
+				t.Fatalf("validateRates: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("validateRates() = %v, want %v", got, tt.want)
+			}
+			for code, rate := range tt.want {
+				if got[code] != rate {
+					t.Errorf("rate of %s = %g, want %g", code, got[code], rate)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUpstream(t *testing.T) {
+	s := &CountryService{currencies: newTestRegistry(t), settings: RefreshSettings{MaxInvalidPct: 50}}
+
+	data := &upstreamData{
+		countries: []models.CountryAPIResponse{
+			{Name: "Nigeria", Currencies: withCurrency("NGN")},
+			{Name: "Zimbabwe", Currencies: withCurrency("ZWL")},
+			{Name: "Lilliput", Currencies: withCurrency("LLP")},
+			{Name: "Atlantis", Population: -5},
+			{Name: "nigeria"},
+		},
+		rates: map[string]float64{"NGN": 1600, "ZWL": 322},
+	}
+	run := &models.RefreshRun{}
+
+	if err := s.validateUpstream(data, run); err != nil {
+		t.Fatalf("validateUpstream: %v", err)
+	}
+
+	var names []string
+	codes := map[string]string{}
+	for _, country := range data.countries {
+		names = append(names, country.Name)
+		if len(country.Currencies) > 0 {
+			codes[country.Name] = country.Currencies[0].Code
+		}
+	}
+	if want := []string{"Nigeria", "Zimbabwe", "Lilliput"}; !slices.Equal(names, want) {
+		t.Errorf("countries = %q, want %q", names, want)
+	}
+	if codes["Zimbabwe"] != "ZWG" {
+		t.Errorf("Zimbabwe currency = %q, want ZWG", codes["Zimbabwe"])
+	}
+	if code, ok := codes["Lilliput"]; ok {
+		t.Errorf("Lilliput currency = %q, want none", code)
+	}
+	if want := []string{"Atlantis", "nigeria"}; !slices.Equal(data.rejected, want) {
+		t.Errorf("rejected = %q, want %q", data.rejected, want)
+	}
+	if data.rates["ZWG"] != 322 {
+		t.Errorf("ZWG rate = %g, want the ZWL rate 322", data.rates["ZWG"])
+	}
+
+	var kept []string
+	for _, rejection := range run.Rejected {
+		if rejection.Kept {
+			kept = append(kept, rejection.Record)
+		}
+	}
+	if want := []string{"Lilliput"}; !slices.Equal(kept, want) {
+		t.Errorf("kept = %q, want %q", kept, want)
+	}
+}
+
+func TestValidateUpstreamAbortsOverInvalidShare(t *testing.T) {
+	s := &CountryService{currencies: newTestRegistry(t), settings: RefreshSettings{MaxInvalidPct: 10}}
+
+	data := &upstreamData{
+		countries: []models.CountryAPIResponse{
+			{Name: "Nigeria"},
+			{Name: ""},
+		},
+	}
+
+	err := s.validateUpstream(data, &models.RefreshRun{})
+	if !errors.Is(err, ErrRefreshAborted) {
+		t.Errorf("validateUpstream() error = %v, want ErrRefreshAborted", err)
+	}
+}